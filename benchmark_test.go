@@ -2,6 +2,7 @@ package bellows
 
 import (
 	"encoding/json"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -47,4 +48,146 @@ func BenchmarkAll(b *testing.B) {
 		flat := Flatten(example)
 		_ = Expand(flat)
 	}
-}
\ No newline at end of file
+}
+
+var largeFlat = func() map[string]interface{} {
+	m := make(map[string]interface{}, 1000)
+	for i := 0; i < 250; i++ {
+		prefix := "items.[" + strconv.Itoa(i) + "]"
+		m[prefix+".name"] = "item"
+		m[prefix+".price"] = i
+		m[prefix+".tags.[0]"] = "a"
+		m[prefix+".tags.[1]"] = "b"
+	}
+	return m
+}()
+
+func BenchmarkExpandLarge(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_ = Expand(largeFlat)
+	}
+}
+
+// BenchmarkSortPaths measures the ordering Expand does up front to be
+// deterministic, compare with BenchmarkExpandLarge for its share of the cost.
+func BenchmarkSortPaths(b *testing.B) {
+	keys := make([]string, 0, len(largeFlat))
+	for key := range largeFlat {
+		keys = append(keys, key)
+	}
+	sorted := make([]string, len(keys))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(sorted, keys)
+		sortPaths(sorted)
+	}
+}
+
+type wideStruct struct {
+	F00, F01, F02, F03, F04, F05, F06, F07, F08, F09 string
+	F10, F11, F12, F13, F14, F15, F16, F17, F18, F19 int
+	F20, F21, F22, F23, F24, F25, F26, F27, F28, F29 bool
+	Nested                                           struct{ A, B, C string }
+}
+
+var (
+	wideExample = wideStruct{F00: "a", F10: 1, F20: true}
+	deepExample = func() interface{} {
+		var v interface{} = "leaf"
+		for i := 0; i < 10; i++ {
+			v = map[string]interface{}{"level" + strconv.Itoa(i): v, "sibling": i}
+		}
+		return v
+	}()
+	sliceExample = func() []int {
+		s := make([]int, 10000)
+		for i := range s {
+			s[i] = i
+		}
+		return s
+	}()
+)
+
+func BenchmarkFlattenWideStruct(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Flatten(wideExample)
+	}
+}
+
+func BenchmarkFlattenDeepMap(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Flatten(deepExample)
+	}
+}
+
+func BenchmarkFlattenLargeSlice(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Flatten(sliceExample, WithPrefix("items"))
+	}
+}
+
+func BenchmarkWalkLargeSlice(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Walk(sliceExample, func(string, interface{}) error { return nil }, WithPrefix("items"))
+	}
+}
+
+// hugeFlat resembles a large export, with 100000 keys across nested slices.
+var hugeFlat = func() map[string]interface{} {
+	m := make(map[string]interface{}, 100000)
+	for i := 0; i < 10000; i++ {
+		prefix := "records.[" + strconv.Itoa(i) + "]"
+		m[prefix+".id"] = i
+		m[prefix+".name"] = "record"
+		m[prefix+".owner.email"] = "owner@example.com"
+		m[prefix+".owner.active"] = true
+		for j := 0; j < 6; j++ {
+			m[prefix+".history.["+strconv.Itoa(j)+"]"] = j
+		}
+	}
+	return m
+}()
+
+func keyBytes(m map[string]interface{}) int64 {
+	var n int64
+	for key := range m {
+		n += int64(len(key))
+	}
+	return n
+}
+
+func BenchmarkExpandHuge(b *testing.B) {
+	b.SetBytes(keyBytes(hugeFlat))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = Expand(hugeFlat)
+	}
+}
+
+func BenchmarkParsePath(b *testing.B) {
+	keys := make([]string, 0, len(hugeFlat))
+	for key := range hugeFlat {
+		keys = append(keys, key)
+	}
+	opts := newOptions(nil)
+	b.SetBytes(keyBytes(hugeFlat))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			_ = opts.parsePath(key)
+		}
+	}
+}
+
+func BenchmarkFlattenerWideStruct(b *testing.B) {
+	f := NewFlattener()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = f.Flatten(wideExample)
+	}
+}
@@ -0,0 +1,795 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const bellowsPath = "github.com/adibaulia/bellows"
+
+// typeKind says how generated code handles a value of some type.
+type typeKind int
+
+const (
+	// kindOther values are handed to bellows.
+	kindOther typeKind = iota
+	// kindValue values are stored and read as they are, such as basic
+	// types and leaves like time.Time.
+	kindValue
+	// kindPointer values are pointers stored and read as they are.
+	kindPointer
+	// kindStruct values are of the types being generated.
+	kindStruct
+	// kindStructPointer values are pointers to the types being generated.
+	kindStructPointer
+	// kindSlice values are slices whose items are handled directly.
+	kindSlice
+	// kindMap values are maps with string keys whose values are flattened
+	// directly.
+	kindMap
+)
+
+// field mirrors what bellows' structFields derives from a struct field.
+type field struct {
+	goName    string
+	key       string
+	inline    bool
+	omitEmpty bool
+	typ       types.Type
+}
+
+// The interfaces bellows looks for, declared here so the package does not
+// need to import them.
+var (
+	emptyInterface = types.NewInterfaceType(nil, nil).Complete()
+	errorType      = types.Universe.Lookup("error").Type()
+	flatMapType    = types.NewMap(types.Typ[types.String], emptyInterface)
+
+	textMarshaler = newInterface("MarshalText", nil, tuple(types.NewSlice(types.Typ[types.Byte]), errorType))
+	flattenable   = newInterface("FlattenBellows", tuple(types.NewSignatureType(nil, nil, nil,
+		tuple(types.Typ[types.String], emptyInterface), nil, false)), nil)
+	expandable = newInterface("ExpandBellows", tuple(flatMapType), tuple(errorType))
+)
+
+func tuple(ts ...types.Type) *types.Tuple {
+	vars := make([]*types.Var, len(ts))
+	for i, t := range ts {
+		vars[i] = types.NewParam(token.NoPos, nil, "", t)
+	}
+	return types.NewTuple(vars...)
+}
+
+func newInterface(method string, params, results *types.Tuple) *types.Interface {
+	sig := types.NewSignatureType(nil, nil, nil, params, results, false)
+	return types.NewInterfaceType([]*types.Func{types.NewFunc(token.NoPos, nil, method, sig)}, nil).Complete()
+}
+
+type generator struct {
+	pkg     *pkg
+	tagName string
+	// prefix starts the names of the package-level helpers.
+	prefix string
+	// generated holds the types being generated, and flattens those of
+	// them that get a FlattenTo method.
+	generated map[*types.Named]bool
+	flattens  map[*types.Named]bool
+	// warnings explain why types did not get a FlattenTo method.
+	warnings []string
+	// imports maps the paths of the packages the output refers to to their
+	// names in it.
+	imports map[string]string
+	// buf holds the generated methods.
+	buf bytes.Buffer
+	// usesIndex, usesIsEmpty and usesMath record which helpers and imports
+	// the methods need.
+	usesIndex, usesIsEmpty, usesMath bool
+}
+
+func newGenerator(p *pkg, tagName, prefix string) *generator {
+	return &generator{
+		pkg:       p,
+		tagName:   tagName,
+		prefix:    prefix,
+		generated: make(map[*types.Named]bool),
+		flattens:  make(map[*types.Named]bool),
+		imports:   map[string]string{bellowsPath: "bellows"},
+	}
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// generate returns the formatted source of the methods for the named types.
+func (g *generator) generate(names []string) ([]byte, error) {
+	var structs []*types.Named
+	for _, name := range names {
+		n, err := g.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		g.generated[n] = true
+		structs = append(structs, n)
+	}
+	for _, n := range structs {
+		if problem := g.flattenProblem(n, "", true, make(map[*types.Named]bool)); problem != "" {
+			g.warnings = append(g.warnings, fmt.Sprintf("%s: no FlattenTo, since %s", n.Obj().Name(), problem))
+		} else {
+			g.flattens[n] = true
+		}
+	}
+	for _, n := range structs {
+		g.generateType(n)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by bellowsgen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", g.pkg.types.Name())
+	g.writeImports(&out)
+	opts := ""
+	if g.tagName != "" {
+		opts = fmt.Sprintf("bellows.WithTagName(%q)", g.tagName)
+	}
+	fmt.Fprintf(&out, "var (\n\t%sFlattener = bellows.NewFlattener(%s)\n\t%sExpander = bellows.NewExpander(%s)\n)\n\n",
+		g.prefix, opts, g.prefix, opts)
+	out.WriteString(strings.ReplaceAll(keyHelpers, "{{.}}", g.prefix))
+	if g.usesIndex {
+		out.WriteString(strings.ReplaceAll(indexHelpers, "{{.}}", g.prefix))
+	}
+	if g.usesIsEmpty {
+		out.WriteString(strings.ReplaceAll(isEmptyHelper, "{{.}}", g.prefix))
+	}
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+// lookup finds the struct type name in the package and checks that the types
+// of its fields are known.
+func (g *generator) lookup(name string) (*types.Named, error) {
+	obj, _ := g.pkg.types.Scope().Lookup(name).(*types.TypeName)
+	var n *types.Named
+	if obj != nil && !obj.IsAlias() {
+		n, _ = obj.Type().(*types.Named)
+	}
+	if n == nil {
+		return nil, fmt.Errorf("struct type %s not found in package %s", name, g.pkg.types.Name())
+	}
+	st, ok := n.Underlying().(*types.Struct)
+	if !ok || n.TypeParams().Len() > 0 {
+		return nil, fmt.Errorf("%s is not a struct type without type parameters", name)
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if f := st.Field(i); strings.Contains(types.TypeString(f.Type(), nil), "invalid type") {
+			return nil, fmt.Errorf("cannot load the type of %s.%s: %w", name, f.Name(), g.pkg.err())
+		}
+	}
+	return n, nil
+}
+
+func (g *generator) writeImports(out *bytes.Buffer) {
+	if g.usesIndex {
+		g.imports["strconv"] = "strconv"
+	}
+	if g.usesIsEmpty {
+		g.imports["reflect"] = "reflect"
+	}
+	if g.usesMath {
+		g.imports["math"] = "math"
+	}
+	var std, other []string
+	for path, name := range g.imports {
+		spec := strconv.Quote(path)
+		if name != pathName(path) {
+			spec = name + " " + spec
+		}
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	out.WriteString("import (\n")
+	for _, spec := range std {
+		fmt.Fprintf(out, "\t%s\n", spec)
+	}
+	if len(std) > 0 {
+		out.WriteString("\n")
+	}
+	for _, spec := range other {
+		fmt.Fprintf(out, "\t%s\n", spec)
+	}
+	out.WriteString(")\n\n")
+}
+
+// pathName returns the last element of an import path.
+func pathName(path string) string {
+	return path[strings.LastIndexByte(path, '/')+1:]
+}
+
+// qualify names p in the output, importing it under a name no other import
+// uses.
+func (g *generator) qualify(p *types.Package) string {
+	if p == g.pkg.types {
+		return ""
+	}
+	if name, ok := g.imports[p.Path()]; ok {
+		return name
+	}
+	taken := make(map[string]bool, len(g.imports)+3)
+	for _, name := range g.imports {
+		taken[name] = true
+	}
+	// Helpers may need these later
+	for _, path := range []string{"strconv", "reflect", "math"} {
+		if path != p.Path() {
+			taken[path] = true
+		}
+	}
+	name := p.Name()
+	for i := 2; taken[name]; i++ {
+		name = p.Name() + strconv.Itoa(i)
+	}
+	g.imports[p.Path()] = name
+	return name
+}
+
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, g.qualify)
+}
+
+// keyHelpers build the keys of fields. FlattenTo appends them to a shared
+// buffer, like the walker does, so only the keys stored allocate.
+const keyHelpers = `func {{.}}Key(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func {{.}}Append(key []byte, name string) []byte {
+	if len(key) > 0 {
+		key = append(key, '.')
+	}
+	return append(key, name...)
+}
+
+func {{.}}Leaf(key []byte, name string) string {
+	if len(key) == 0 {
+		return name
+	}
+	return string({{.}}Append(key, name))
+}
+
+`
+
+// indexHelpers build the keys of slice items.
+const indexHelpers = `func {{.}}Index(path string, i int) string {
+	return path + ".[" + strconv.Itoa(i) + "]"
+}
+
+func {{.}}AppendIndex(key []byte, i int) []byte {
+	key = append(key, ".["...)
+	key = strconv.AppendInt(key, int64(i), 10)
+	return append(key, ']')
+}
+
+`
+
+const isEmptyHelper = `// {{.}}IsEmpty reports whether *p is empty in the sense of omitempty.
+func {{.}}IsEmpty(p interface{}) bool {
+	v := reflect.ValueOf(p).Elem()
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+`
+
+// fields lists the fields of st the way bellows' structFields does.
+func (g *generator) fields(st *types.Struct) []field {
+	var fields []field
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if !f.Exported() {
+			continue
+		}
+		tag := reflect.StructTag(st.Tag(i))
+		fd := field{goName: f.Name(), key: f.Name(), inline: f.Embedded(), typ: f.Type()}
+		if g.tagName != "" {
+			value, ok := tag.Lookup(g.tagName)
+			if value == "-" {
+				continue
+			}
+			tagged, flags, _ := strings.Cut(value, ",")
+			if tagged != "" {
+				fd.key = tagged
+				fd.inline = false
+			}
+			for ok && flags != "" {
+				var flag string
+				flag, flags, _ = strings.Cut(flags, ",")
+				switch flag {
+				case "omitempty":
+					fd.omitEmpty = true
+				case "inline", "squash":
+					fd.inline = true
+				}
+			}
+		}
+		fields = append(fields, fd)
+	}
+	return fields
+}
+
+// implements reports whether t has the methods of iface.
+func implements(t types.Type, iface *types.Interface) bool {
+	return types.Implements(t, iface)
+}
+
+// implementsAddr is like implements, but also counts the methods of *t, as
+// bellows does for addressable values.
+func implementsAddr(t types.Type, iface *types.Interface) bool {
+	if implements(t, iface) {
+		return true
+	}
+	return !isPointer(t) && !isInterface(t) && implements(types.NewPointer(t), iface)
+}
+
+// isLeaf reports whether bellows stores values of t whole.
+func isLeaf(t types.Type) bool {
+	return !isInterface(t) && implementsAddr(t, textMarshaler)
+}
+
+func isInterface(t types.Type) bool {
+	return types.IsInterface(t)
+}
+
+func isPointer(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Pointer)
+	return ok
+}
+
+func isBasic(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Basic)
+	return ok
+}
+
+// isString reports whether t is a string type, which bellows uses as a map key
+// as it is.
+func isString(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsString != 0
+}
+
+// isComposite reports whether bellows walks into values of t.
+func isComposite(t types.Type) bool {
+	switch t.Underlying().(type) {
+	case *types.Struct, *types.Map, *types.Array, *types.Slice:
+		return true
+	}
+	return false
+}
+
+// named returns t as a named type, or nil.
+func named(t types.Type) *types.Named {
+	n, _ := types.Unalias(t).(*types.Named)
+	return n
+}
+
+// nameable reports whether the output can spell t in type assertions and
+// conversions.
+func (g *generator) nameable(t types.Type) bool {
+	switch t := types.Unalias(t).(type) {
+	case *types.Basic:
+		return t.Kind() != types.Invalid
+	case *types.Named:
+		if obj := t.Obj(); obj.Pkg() != nil && obj.Pkg() != g.pkg.types && !obj.Exported() {
+			return false
+		}
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			if !g.nameable(t.TypeArgs().At(i)) {
+				return false
+			}
+		}
+		return true
+	case *types.Pointer:
+		return g.nameable(t.Elem())
+	case *types.Slice:
+		return g.nameable(t.Elem())
+	case *types.Array:
+		return g.nameable(t.Elem())
+	case *types.Map:
+		return g.nameable(t.Key()) && g.nameable(t.Elem())
+	}
+	return false
+}
+
+// flattenProblem explains why FlattenTo of a value of t, the type of field,
+// could differ from reflection, or returns "". Reflection detects cycles, so
+// values must not be able to refer back to themselves. byValue tells whether
+// the value is reached without following pointers, slices or maps, where
+// reflection calls methods with pointer receivers only if the outermost value
+// is addressable.
+func (g *generator) flattenProblem(t types.Type, field string, byValue bool, seen map[*types.Named]bool) string {
+	if isInterface(t) {
+		return fmt.Sprintf("field %s can hold values of any type", field)
+	}
+	if isLeaf(t) || implements(t, flattenable) || !byValue && implementsAddr(t, flattenable) {
+		// Stored without looking inside
+		return ""
+	}
+	if implementsAddr(t, flattenable) {
+		return fmt.Sprintf("field %s implements bellows.Flattenable with a pointer receiver", field)
+	}
+	if n := named(t); n != nil {
+		if seen[n] {
+			return fmt.Sprintf("type %s refers to itself", n.Obj().Name())
+		}
+		seen[n] = true
+		defer delete(seen, n)
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		return g.flattenProblem(u.Elem(), field, false, seen)
+	case *types.Slice:
+		return g.flattenProblem(u.Elem(), field, false, seen)
+	case *types.Map:
+		return g.flattenProblem(u.Elem(), field, false, seen)
+	case *types.Array:
+		return g.flattenProblem(u.Elem(), field, byValue, seen)
+	case *types.Struct:
+		for _, f := range g.fields(u) {
+			name := f.goName
+			if field != "" {
+				name = field + "." + name
+			}
+			if problem := g.flattenProblem(f.typ, name, byValue, seen); problem != "" {
+				return problem
+			}
+		}
+	}
+	return ""
+}
+
+// flattenKind says how FlattenTo stores a value of t, following what the
+// walker does with it.
+func (g *generator) flattenKind(t types.Type) typeKind {
+	if isInterface(t) || implementsAddr(t, flattenable) {
+		return kindOther
+	}
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		switch elem := p.Elem(); {
+		case isLeaf(elem) || !isComposite(elem):
+			return kindPointer
+		case g.flattens[named(elem)]:
+			return kindStructPointer
+		}
+		return kindOther
+	}
+	if isLeaf(t) {
+		return kindValue
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return kindValue
+	case *types.Struct:
+		if g.flattens[named(t)] {
+			return kindStruct
+		}
+	case *types.Slice:
+		if g.flattenKind(u.Elem()) != kindOther {
+			return kindSlice
+		}
+	case *types.Map:
+		if isString(u.Key()) && g.flattenKind(u.Elem()) != kindOther {
+			return kindMap
+		}
+	}
+	return kindOther
+}
+
+// expandKind says how ExpandFrom reads a value of t, following what
+// ExpandInto does with it.
+func (g *generator) expandKind(t types.Type) typeKind {
+	if isInterface(t) || implementsAddr(t, expandable) || !g.nameable(t) {
+		return kindOther
+	}
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		switch elem := p.Elem(); {
+		case g.generated[named(elem)]:
+			return kindStructPointer
+		case isLeaf(elem) || isBasic(elem):
+			return kindPointer
+		}
+		return kindOther
+	}
+	if isLeaf(t) || isBasic(t) {
+		return kindValue
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Struct:
+		if g.generated[named(t)] {
+			return kindStruct
+		}
+	case *types.Slice:
+		if !isInterface(u.Elem()) {
+			return kindSlice
+		}
+	}
+	return kindOther
+}
+
+// notEmpty returns the condition under which expr, of type t, is kept with
+// omitempty.
+func (g *generator) notEmpty(expr string, t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch info := u.Info(); {
+		case info&types.IsBoolean != 0:
+			return expr
+		case info&types.IsString != 0:
+			return expr + ` != ""`
+		case info&types.IsFloat != 0:
+			// Like reflect.Value.IsZero, -0 is not empty
+			g.usesMath = true
+			return "math.Float64bits(float64(" + expr + ")) != 0"
+		case info&types.IsInteger != 0:
+			return expr + " != 0"
+		case u.Kind() == types.UnsafePointer:
+			return expr + " != nil"
+		}
+	case *types.Pointer, *types.Interface, *types.Signature, *types.Chan:
+		return expr + " != nil"
+	case *types.Map, *types.Slice, *types.Array:
+		return "len(" + expr + ") != 0"
+	}
+	g.usesIsEmpty = true
+	return "!" + g.prefix + "IsEmpty(&" + expr + ")"
+}
+
+// varName numbers the variables of nested slices.
+func varName(base string, depth int) string {
+	if depth <= 1 {
+		return base
+	}
+	return base + strconv.Itoa(depth)
+}
+
+func (g *generator) generateType(n *types.Named) {
+	name := n.Obj().Name()
+	st := n.Underlying().(*types.Struct)
+	if g.tagName != "" {
+		g.printf("// BellowsTagName tells bellows which struct tag the generated methods use.\n")
+		g.printf("func (%s) BellowsTagName() string {\n\treturn %q\n}\n\n", name, g.tagName)
+	}
+
+	if g.flattens[n] {
+		g.printf("// FlattenTo implements bellows.MapFlattener.\n")
+		g.printf("func (s %s) FlattenTo(m map[string]interface{}, prefix string) {\n", name)
+		g.printf("\tvar buf [64]byte\n\ts.bellowsFlattenTo(m, append(buf[:0], prefix...))\n}\n\n")
+		g.printf("func (s *%s) bellowsFlattenTo(m map[string]interface{}, key []byte) {\n", name)
+		g.flattenFields("s", st, "key")
+		g.printf("}\n\n")
+	}
+
+	g.printf("// ExpandFrom implements bellows.MapExpander.\n")
+	g.printf("func (s *%s) ExpandFrom(flat map[string]interface{}) error {\n", name)
+	g.printf("\ttree, err := %sExpander.ExpandE(flat)\n", g.prefix)
+	g.printf("\tif err != nil || tree == nil {\n\t\treturn err\n\t}\n")
+	g.printf("\tif m, ok := tree.(map[string]interface{}); ok {\n\t\treturn s.bellowsDecode(m, \"\")\n\t}\n")
+	g.printf("\treturn %sExpander.DecodeInto(tree, \"\", s)\n}\n\n", g.prefix)
+
+	g.printf("func (s *%s) bellowsDecode(m map[string]interface{}, path string) error {\n", name)
+	if g.hasInlineMap(st, make(map[*types.Named]bool)) {
+		// The inlined map gets the keys no field uses, which only
+		// reflection keeps track of
+		g.printf("\treturn %sExpander.DecodeInto(m, path, s)\n}\n\n", g.prefix)
+		return
+	}
+	g.decodeFields("s", st, "path", make(map[*types.Named]bool))
+	g.printf("\treturn nil\n}\n\n")
+}
+
+// flattenFields stores the fields of recv, a struct of type st, below the key
+// held in the []byte variable key.
+func (g *generator) flattenFields(recv string, st *types.Struct, key string) {
+	for _, f := range g.fields(st) {
+		expr := recv + "." + f.goName
+		// Slices and maps without items produce no keys anyway
+		omitEmpty := f.omitEmpty && !isContainer(g.flattenKind(f.typ))
+		if omitEmpty {
+			g.printf("if %s {\n", g.notEmpty(expr, f.typ))
+		}
+		elem, isStruct := f.typ.Underlying().(*types.Struct)
+		switch {
+		case f.inline && isStruct && !isLeaf(f.typ) && !implementsAddr(f.typ, flattenable):
+			// Embedded structs are promoted to the parent's level
+			if g.flattens[named(f.typ)] {
+				g.printf("%s.bellowsFlattenTo(m, %s)\n", expr, key)
+			} else {
+				g.flattenFields(expr, elem, key)
+			}
+		case f.inline:
+			g.printf("%sFlattener.FlattenPrefixedToResult(%s, string(%s), m)\n", g.prefix, expr, key)
+		default:
+			g.flattenValue(expr, f.typ, flatKey{
+				bytes: fmt.Sprintf("%sAppend(%s, %q)", g.prefix, key, f.key),
+				str:   fmt.Sprintf("%sLeaf(%s, %q)", g.prefix, key, f.key),
+			}, 1)
+		}
+		if omitEmpty {
+			g.printf("}\n")
+		}
+	}
+}
+
+// isContainer reports whether values of kind k are slices or maps.
+func isContainer(k typeKind) bool {
+	return k == kindSlice || k == kindMap
+}
+
+// flatKey holds the expressions of a key as a []byte, to append to, and as a
+// string, to store.
+type flatKey struct {
+	bytes, str string
+}
+
+// flattenValue stores expr, of type t, at key.
+func (g *generator) flattenValue(expr string, t types.Type, key flatKey, depth int) {
+	switch g.flattenKind(t) {
+	case kindValue:
+		g.printf("m[%s] = %s\n", key.str, expr)
+	case kindPointer:
+		g.printf("if %s == nil {\nm[%s] = nil\n} else {\nm[%s] = %s\n}\n", expr, key.str, key.str, expr)
+	case kindStruct:
+		g.printf("%s.bellowsFlattenTo(m, %s)\n", expr, key.bytes)
+	case kindStructPointer:
+		g.printf("if %s == nil {\nm[%s] = nil\n} else {\n%s.bellowsFlattenTo(m, %s)\n}\n", expr, key.str, expr, key.bytes)
+	case kindSlice:
+		g.usesIndex = true
+		k, i := varName("k", depth), varName("i", depth)
+		g.printf("if len(%s) != 0 {\n%s := %s\nfor %s := range %s {\n", expr, k, key.bytes, i, expr)
+		elem := t.Underlying().(*types.Slice).Elem()
+		item := fmt.Sprintf("%sAppendIndex(%s, %s)", g.prefix, k, i)
+		g.flattenValue(expr+"["+i+"]", elem, flatKey{bytes: item, str: "string(" + item + ")"}, depth+1)
+		g.printf("}\n}\n")
+	case kindMap:
+		k, mk, mv := varName("k", depth), varName("mk", depth), varName("mv", depth)
+		g.printf("if len(%s) != 0 {\n%s := %s\nfor %s, %s := range %s {\n", expr, k, key.bytes, mk, mv, expr)
+		name := mk
+		if !types.Identical(t.Underlying().(*types.Map).Key(), types.Typ[types.String]) {
+			name = "string(" + mk + ")"
+		}
+		g.flattenValue(mv, t.Underlying().(*types.Map).Elem(), flatKey{
+			bytes: fmt.Sprintf("%sAppend(%s, %s)", g.prefix, k, name),
+			str:   fmt.Sprintf("%sLeaf(%s, %s)", g.prefix, k, name),
+		}, depth+1)
+		g.printf("}\n}\n")
+	default:
+		g.printf("%sFlattener.FlattenPrefixedToResult(%s, %s, m)\n", g.prefix, expr, key.str)
+	}
+}
+
+// decodeFields reads the fields of recv, a struct of type st, from the map m
+// found at path. inlined holds the embedded types being expanded, so
+// embedded pointers to the enclosing type are left to bellows.
+func (g *generator) decodeFields(recv string, st *types.Struct, path string, inlined map[*types.Named]bool) {
+	for _, f := range g.fields(st) {
+		expr := recv + "." + f.goName
+		if f.inline {
+			g.decodeInline(expr, f.typ, path, inlined)
+			continue
+		}
+		g.printf("if v, ok := m[%q]; ok {\n", f.key)
+		g.decodeValue("v", expr, f.typ, fmt.Sprintf("%sKey(%s, %q)", g.prefix, path, f.key), 1)
+		g.printf("}\n")
+	}
+}
+
+// hasInlineMap reports whether st, or a struct inlined in it, inlines a map.
+func (g *generator) hasInlineMap(st *types.Struct, seen map[*types.Named]bool) bool {
+	for _, f := range g.fields(st) {
+		if !f.inline {
+			continue
+		}
+		t := f.typ
+		if p, ok := t.Underlying().(*types.Pointer); ok {
+			t = p.Elem()
+		}
+		switch u := t.Underlying().(type) {
+		case *types.Map:
+			return true
+		case *types.Struct:
+			if n := named(t); n != nil {
+				if seen[n] {
+					continue
+				}
+				seen[n] = true
+			}
+			if g.hasInlineMap(u, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeInline reads the embedded struct expr, of type t, from the fields of
+// its parent. Embedded types other than structs, pointers to them and maps are
+// left alone, like ExpandInto does; types inlining maps are decoded with
+// reflection instead, see hasInlineMap.
+func (g *generator) decodeInline(expr string, t types.Type, path string, inlined map[*types.Named]bool) {
+	elem := t
+	p, isPtr := t.Underlying().(*types.Pointer)
+	if isPtr {
+		elem = p.Elem()
+	}
+	st, ok := elem.Underlying().(*types.Struct)
+	if !ok {
+		return
+	}
+	n := named(elem)
+	if n != nil && inlined[n] || isPtr && !g.nameable(elem) {
+		g.printf("if err := %sExpander.DecodeInto(m, %s, &%s); err != nil {\nreturn err\n}\n", g.prefix, path, expr)
+		return
+	}
+	if isPtr {
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n", expr, expr, g.typeString(elem))
+	}
+	if g.generated[n] {
+		g.printf("if err := %s.bellowsDecode(m, %s); err != nil {\nreturn err\n}\n", expr, path)
+		return
+	}
+	if n != nil {
+		inlined[n] = true
+		defer delete(inlined, n)
+	}
+	g.decodeFields(expr, st, path, inlined)
+}
+
+// decodeValue stores v, a value built by Expand, in dst of type t. path is the
+// expression of v's key, only evaluated where needed.
+func (g *generator) decodeValue(v, dst string, t types.Type, path string, depth int) {
+	fallback := fmt.Sprintf(" else if err := %sExpander.DecodeInto(%s, %s, &%s); err != nil {\nreturn err\n}\n",
+		g.prefix, v, path, dst)
+	x := varName("x", depth)
+	switch g.expandKind(t) {
+	case kindValue, kindPointer:
+		g.printf("if %s, ok := %s.(%s); ok {\n%s = %s\n}%s", x, v, g.typeString(t), dst, x, fallback)
+	case kindStruct:
+		g.printf("if %s, ok := %s.(map[string]interface{}); ok {\n", x, v)
+		g.printf("if err := %s.bellowsDecode(%s, %s); err != nil {\nreturn err\n}\n}%s", dst, x, path, fallback)
+	case kindStructPointer:
+		g.printf("if %s, ok := %s.(map[string]interface{}); ok {\n", x, v)
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n", dst, dst, g.typeString(t.Underlying().(*types.Pointer).Elem()))
+		g.printf("if err := %s.bellowsDecode(%s, %s); err != nil {\nreturn err\n}\n}%s", dst, x, path, fallback)
+	case kindSlice:
+		g.usesIndex = true
+		p, i, e := varName("p", depth), varName("i", depth), varName("e", depth)
+		g.printf("if %s, ok := %s.([]interface{}); ok {\n%s := %s\n", x, v, p, path)
+		g.printf("%s = make(%s, len(%s))\nfor %s, %s := range %s {\n", dst, g.typeString(t), x, i, e, x)
+		elem := t.Underlying().(*types.Slice).Elem()
+		g.decodeValue(e, dst+"["+i+"]", elem, fmt.Sprintf("%sIndex(%s, %s)", g.prefix, p, i), depth+1)
+		g.printf("}\n}%s", fallback)
+	default:
+		g.printf("if err := %sExpander.DecodeInto(%s, %s, &%s); err != nil {\nreturn err\n}\n", g.prefix, v, path, dst)
+	}
+}
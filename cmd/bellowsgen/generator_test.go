@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// generateFrom writes files, named by their keys, to a package directory and
+// generates the methods of the named types in it.
+func generateFrom(t *testing.T, files map[string]string, tagName string, names ...string) (string, []string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := loadPackage(dir, "bellows_gen.go")
+	if err != nil {
+		return "", nil, err
+	}
+	g := newGenerator(p, tagName, "bellowsGen")
+	out, err := g.generate(names)
+	return string(out), g.warnings, err
+}
+
+func TestGenerateFields(t *testing.T) {
+	src := `package demo
+
+type Level string
+
+type Demo struct {
+	Name    string            ` + "`json:\"name\"`" + `
+	Tags    []string          ` + "`json:\"tags,omitempty\"`" + `
+	Labels  map[string]string ` + "`json:\"labels\"`" + `
+	Skipped string            ` + "`json:\"-\"`" + `
+	hidden  int
+	Level
+}
+`
+	out, warnings, err := generateFrom(t, map[string]string{"types.go": src}, "json", "Demo")
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Contains(t, out, `m[bellowsGenLeaf(key, "name")] = s.Name`)
+	assert.Contains(t, out, "m[string(bellowsGenAppendIndex(k, i))] = s.Tags[i]")
+	assert.Contains(t, out, "m[bellowsGenLeaf(k, mk)] = mv")
+	assert.Contains(t, out, `bellowsGenFlattener.FlattenPrefixedToResult(s.Level, string(key), m)`)
+	assert.NotContains(t, out, "Skipped")
+	assert.NotContains(t, out, "hidden")
+	// Embedded types that are not structs are left alone by ExpandInto
+	assert.NotContains(t, out, "&s.Level")
+	assert.Contains(t, out, `return "json"`)
+}
+
+func TestGenerateSkipsFlattenToOfCyclicTypes(t *testing.T) {
+	src := `package demo
+
+type Node struct {
+	Name string
+	Next *Node
+}
+
+type Any struct {
+	Value interface{}
+}
+`
+	out, warnings, err := generateFrom(t, map[string]string{"types.go": src}, "", "Node", "Any")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"Node: no FlattenTo, since type Node refers to itself",
+		"Any: no FlattenTo, since field Value can hold values of any type",
+	}, warnings)
+	assert.NotContains(t, out, "FlattenTo")
+	assert.Contains(t, out, "func (s *Node) ExpandFrom(")
+	assert.Contains(t, out, "func (s *Any) ExpandFrom(")
+}
+
+func TestGenerateHonorsBuildConstraints(t *testing.T) {
+	files := map[string]string{
+		"types.go":      "package demo\n\ntype Demo struct {\n\tName string\n}\n",
+		"ignored.go":    "//go:build ignore\n\npackage demo\n\ntype Demo struct {\n\tIgnored string\n}\n",
+		"other_test.go": "package demo\n\ntype Extra struct{}\n",
+	}
+	out, _, err := generateFrom(t, files, "", "Demo")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "s.Name")
+	assert.NotContains(t, out, "Ignored")
+}
+
+func TestGenerateUnknownType(t *testing.T) {
+	_, _, err := generateFrom(t, map[string]string{"types.go": "package demo\n"}, "", "Missing")
+	assert.EqualError(t, err, "struct type Missing not found in package demo")
+}
+
+func TestHelperPrefix(t *testing.T) {
+	tests := map[string]string{
+		"bellows_gen.go":        "bellowsGen",
+		"config_gen.go":         "bellowsConfigGen",
+		"gen/bellows-server.go": "bellowsServer",
+		"bellows.go":            "bellows",
+	}
+	for output, expected := range tests {
+		assert.Equal(t, expected, helperPrefix(output), output)
+	}
+}
@@ -0,0 +1,370 @@
+// Code generated by bellowsgen; DO NOT EDIT.
+
+package example
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/adibaulia/bellows"
+)
+
+var (
+	bellowsGenFlattener = bellows.NewFlattener(bellows.WithTagName("json"))
+	bellowsGenExpander  = bellows.NewExpander(bellows.WithTagName("json"))
+)
+
+func bellowsGenKey(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func bellowsGenAppend(key []byte, name string) []byte {
+	if len(key) > 0 {
+		key = append(key, '.')
+	}
+	return append(key, name...)
+}
+
+func bellowsGenLeaf(key []byte, name string) string {
+	if len(key) == 0 {
+		return name
+	}
+	return string(bellowsGenAppend(key, name))
+}
+
+func bellowsGenIndex(path string, i int) string {
+	return path + ".[" + strconv.Itoa(i) + "]"
+}
+
+func bellowsGenAppendIndex(key []byte, i int) []byte {
+	key = append(key, ".["...)
+	key = strconv.AppendInt(key, int64(i), 10)
+	return append(key, ']')
+}
+
+// bellowsGenIsEmpty reports whether *p is empty in the sense of omitempty.
+func bellowsGenIsEmpty(p interface{}) bool {
+	v := reflect.ValueOf(p).Elem()
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// BellowsTagName tells bellows which struct tag the generated methods use.
+func (Config) BellowsTagName() string {
+	return "json"
+}
+
+// FlattenTo implements bellows.MapFlattener.
+func (s Config) FlattenTo(m map[string]interface{}, prefix string) {
+	var buf [64]byte
+	s.bellowsFlattenTo(m, append(buf[:0], prefix...))
+}
+
+func (s *Config) bellowsFlattenTo(m map[string]interface{}, key []byte) {
+	m[bellowsGenLeaf(key, "name")] = s.Name
+	if s.Port != 0 {
+		m[bellowsGenLeaf(key, "port")] = s.Port
+	}
+	m[bellowsGenLeaf(key, "debug")] = s.Debug
+	m[bellowsGenLeaf(key, "ratio")] = s.Ratio
+	s.Limits.bellowsFlattenTo(m, bellowsGenAppend(key, "limits"))
+	if len(s.Servers) != 0 {
+		k := bellowsGenAppend(key, "servers")
+		for i := range s.Servers {
+			s.Servers[i].bellowsFlattenTo(m, bellowsGenAppendIndex(k, i))
+		}
+	}
+	if len(s.Labels) != 0 {
+		k := bellowsGenAppend(key, "labels")
+		for mk, mv := range s.Labels {
+			m[bellowsGenLeaf(k, mk)] = mv
+		}
+	}
+	m[bellowsGenLeaf(key, "started")] = s.Started
+	if s.Owner == nil {
+		m[bellowsGenLeaf(key, "owner")] = nil
+	} else {
+		s.Owner.bellowsFlattenTo(m, bellowsGenAppend(key, "owner"))
+	}
+	m[bellowsGenLeaf(key, "created_by")] = s.Audit.CreatedBy
+}
+
+// ExpandFrom implements bellows.MapExpander.
+func (s *Config) ExpandFrom(flat map[string]interface{}) error {
+	tree, err := bellowsGenExpander.ExpandE(flat)
+	if err != nil || tree == nil {
+		return err
+	}
+	if m, ok := tree.(map[string]interface{}); ok {
+		return s.bellowsDecode(m, "")
+	}
+	return bellowsGenExpander.DecodeInto(tree, "", s)
+}
+
+func (s *Config) bellowsDecode(m map[string]interface{}, path string) error {
+	if v, ok := m["name"]; ok {
+		if x, ok := v.(string); ok {
+			s.Name = x
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "name"), &s.Name); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["port"]; ok {
+		if x, ok := v.(int); ok {
+			s.Port = x
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "port"), &s.Port); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["debug"]; ok {
+		if x, ok := v.(bool); ok {
+			s.Debug = x
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "debug"), &s.Debug); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["ratio"]; ok {
+		if x, ok := v.(float64); ok {
+			s.Ratio = x
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "ratio"), &s.Ratio); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["limits"]; ok {
+		if x, ok := v.(map[string]interface{}); ok {
+			if err := s.Limits.bellowsDecode(x, bellowsGenKey(path, "limits")); err != nil {
+				return err
+			}
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "limits"), &s.Limits); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["servers"]; ok {
+		if x, ok := v.([]interface{}); ok {
+			p := bellowsGenKey(path, "servers")
+			s.Servers = make([]Server, len(x))
+			for i, e := range x {
+				if x2, ok := e.(map[string]interface{}); ok {
+					if err := s.Servers[i].bellowsDecode(x2, bellowsGenIndex(p, i)); err != nil {
+						return err
+					}
+				} else if err := bellowsGenExpander.DecodeInto(e, bellowsGenIndex(p, i), &s.Servers[i]); err != nil {
+					return err
+				}
+			}
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "servers"), &s.Servers); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["labels"]; ok {
+		if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "labels"), &s.Labels); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["started"]; ok {
+		if x, ok := v.(time.Time); ok {
+			s.Started = x
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "started"), &s.Started); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["owner"]; ok {
+		if x, ok := v.(map[string]interface{}); ok {
+			if s.Owner == nil {
+				s.Owner = new(Server)
+			}
+			if err := s.Owner.bellowsDecode(x, bellowsGenKey(path, "owner")); err != nil {
+				return err
+			}
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "owner"), &s.Owner); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["created_by"]; ok {
+		if x, ok := v.(string); ok {
+			s.Audit.CreatedBy = x
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "created_by"), &s.Audit.CreatedBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BellowsTagName tells bellows which struct tag the generated methods use.
+func (Server) BellowsTagName() string {
+	return "json"
+}
+
+// FlattenTo implements bellows.MapFlattener.
+func (s Server) FlattenTo(m map[string]interface{}, prefix string) {
+	var buf [64]byte
+	s.bellowsFlattenTo(m, append(buf[:0], prefix...))
+}
+
+func (s *Server) bellowsFlattenTo(m map[string]interface{}, key []byte) {
+	m[bellowsGenLeaf(key, "host")] = s.Host
+	m[bellowsGenLeaf(key, "port")] = s.Port
+}
+
+// ExpandFrom implements bellows.MapExpander.
+func (s *Server) ExpandFrom(flat map[string]interface{}) error {
+	tree, err := bellowsGenExpander.ExpandE(flat)
+	if err != nil || tree == nil {
+		return err
+	}
+	if m, ok := tree.(map[string]interface{}); ok {
+		return s.bellowsDecode(m, "")
+	}
+	return bellowsGenExpander.DecodeInto(tree, "", s)
+}
+
+func (s *Server) bellowsDecode(m map[string]interface{}, path string) error {
+	if v, ok := m["host"]; ok {
+		if x, ok := v.(string); ok {
+			s.Host = x
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "host"), &s.Host); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["port"]; ok {
+		if x, ok := v.(uint16); ok {
+			s.Port = x
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "port"), &s.Port); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BellowsTagName tells bellows which struct tag the generated methods use.
+func (Limits) BellowsTagName() string {
+	return "json"
+}
+
+// FlattenTo implements bellows.MapFlattener.
+func (s Limits) FlattenTo(m map[string]interface{}, prefix string) {
+	var buf [64]byte
+	s.bellowsFlattenTo(m, append(buf[:0], prefix...))
+}
+
+func (s *Limits) bellowsFlattenTo(m map[string]interface{}, key []byte) {
+	m[bellowsGenLeaf(key, "max_conns")] = s.MaxConns
+	if math.Float64bits(float64(s.Burst)) != 0 {
+		m[bellowsGenLeaf(key, "burst")] = s.Burst
+	}
+}
+
+// ExpandFrom implements bellows.MapExpander.
+func (s *Limits) ExpandFrom(flat map[string]interface{}) error {
+	tree, err := bellowsGenExpander.ExpandE(flat)
+	if err != nil || tree == nil {
+		return err
+	}
+	if m, ok := tree.(map[string]interface{}); ok {
+		return s.bellowsDecode(m, "")
+	}
+	return bellowsGenExpander.DecodeInto(tree, "", s)
+}
+
+func (s *Limits) bellowsDecode(m map[string]interface{}, path string) error {
+	if v, ok := m["max_conns"]; ok {
+		if x, ok := v.(int); ok {
+			s.MaxConns = x
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "max_conns"), &s.MaxConns); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["burst"]; ok {
+		if x, ok := v.(float32); ok {
+			s.Burst = x
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "burst"), &s.Burst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BellowsTagName tells bellows which struct tag the generated methods use.
+func (Node) BellowsTagName() string {
+	return "json"
+}
+
+// ExpandFrom implements bellows.MapExpander.
+func (s *Node) ExpandFrom(flat map[string]interface{}) error {
+	tree, err := bellowsGenExpander.ExpandE(flat)
+	if err != nil || tree == nil {
+		return err
+	}
+	if m, ok := tree.(map[string]interface{}); ok {
+		return s.bellowsDecode(m, "")
+	}
+	return bellowsGenExpander.DecodeInto(tree, "", s)
+}
+
+func (s *Node) bellowsDecode(m map[string]interface{}, path string) error {
+	if v, ok := m["name"]; ok {
+		if x, ok := v.(string); ok {
+			s.Name = x
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "name"), &s.Name); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["next"]; ok {
+		if x, ok := v.(map[string]interface{}); ok {
+			if s.Next == nil {
+				s.Next = new(Node)
+			}
+			if err := s.Next.bellowsDecode(x, bellowsGenKey(path, "next")); err != nil {
+				return err
+			}
+		} else if err := bellowsGenExpander.DecodeInto(v, bellowsGenKey(path, "next"), &s.Next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BellowsTagName tells bellows which struct tag the generated methods use.
+func (Trace) BellowsTagName() string {
+	return "json"
+}
+
+// FlattenTo implements bellows.MapFlattener.
+func (s Trace) FlattenTo(m map[string]interface{}, prefix string) {
+	var buf [64]byte
+	s.bellowsFlattenTo(m, append(buf[:0], prefix...))
+}
+
+func (s *Trace) bellowsFlattenTo(m map[string]interface{}, key []byte) {
+	m[bellowsGenLeaf(key, "name")] = s.Name
+	if !bellowsGenIsEmpty(&s.Audit) {
+		m[bellowsGenLeaf(key, "created_by")] = s.Audit.CreatedBy
+	}
+	bellowsGenFlattener.FlattenPrefixedToResult(s.Extra, string(key), m)
+}
+
+// ExpandFrom implements bellows.MapExpander.
+func (s *Trace) ExpandFrom(flat map[string]interface{}) error {
+	tree, err := bellowsGenExpander.ExpandE(flat)
+	if err != nil || tree == nil {
+		return err
+	}
+	if m, ok := tree.(map[string]interface{}); ok {
+		return s.bellowsDecode(m, "")
+	}
+	return bellowsGenExpander.DecodeInto(tree, "", s)
+}
+
+func (s *Trace) bellowsDecode(m map[string]interface{}, path string) error {
+	return bellowsGenExpander.DecodeInto(m, path, s)
+}
@@ -0,0 +1,50 @@
+// Package example holds types flattened by code generated with bellowsgen,
+// to check that it matches the reflection path.
+package example
+
+import "time"
+
+//go:generate go run ../.. -type=Config,Server,Limits,Node,Trace -tag=json
+
+type Config struct {
+	Name     string            `json:"name"`
+	Port     int               `json:"port,omitempty"`
+	Debug    bool              `json:"debug"`
+	Ratio    float64           `json:"ratio"`
+	Limits   Limits            `json:"limits"`
+	Servers  []Server          `json:"servers"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Started  time.Time         `json:"started"`
+	Owner    *Server           `json:"owner"`
+	Secret   string            `json:"-"`
+	internal string
+	Audit
+}
+
+type Server struct {
+	Host string `json:"host"`
+	Port uint16 `json:"port"`
+}
+
+type Limits struct {
+	MaxConns int     `json:"max_conns"`
+	Burst    float32 `json:"burst,omitempty"`
+}
+
+type Audit struct {
+	CreatedBy string `json:"created_by"`
+}
+
+// Trace inlines a struct that is dropped when empty and a map that collects
+// the keys no other field uses.
+type Trace struct {
+	Name  string `json:"name"`
+	Audit `json:",omitempty"`
+	Extra map[string]string `json:",inline"`
+}
+
+// Node can refer to itself, so it only gets ExpandFrom.
+type Node struct {
+	Name string `json:"name"`
+	Next *Node  `json:"next"`
+}
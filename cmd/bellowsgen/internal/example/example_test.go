@@ -0,0 +1,156 @@
+package example
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adibaulia/bellows"
+	"github.com/stretchr/testify/assert"
+)
+
+// reflectionOnly changes nothing about the output, but is not a default
+// option, so bellows does not use the generated methods.
+var reflectionOnly = bellows.WithMaxIndex(1 << 30)
+
+var config = Config{
+	Name:    "app",
+	Port:    8080,
+	Debug:   true,
+	Ratio:   0.5,
+	Limits:  Limits{MaxConns: 10},
+	Servers: []Server{{Host: "a", Port: 1}, {Host: "b", Port: 2}},
+	Labels:  map[string]string{"team": "core"},
+	Started: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	Owner:   &Server{Host: "owner"},
+	Secret:  "hunter2",
+	Audit:   Audit{CreatedBy: "ci"},
+}
+
+func TestGeneratedFlattenMatchesReflection(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{name: "full", value: config},
+		{name: "zero", value: Config{}},
+		{name: "pointer", value: &config},
+		{name: "nested in map", value: map[string]interface{}{"cfg": config}},
+		{name: "empty inline", value: Trace{Name: "a"}},
+		{name: "inline", value: Trace{Name: "a", Audit: Audit{CreatedBy: "ci"}, Extra: map[string]string{"k": "v"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := bellows.Flatten(tt.value, bellows.WithTagName("json"), reflectionOnly)
+			assert.Equal(t, expected, bellows.Flatten(tt.value, bellows.WithTagName("json")))
+
+			if mf, ok := tt.value.(bellows.MapFlattener); ok {
+				m := map[string]interface{}{}
+				mf.FlattenTo(m, "")
+				assert.Equal(t, expected, m)
+			}
+		})
+	}
+}
+
+func TestGeneratedExpandMatchesReflection(t *testing.T) {
+	flat := bellows.Flatten(config, bellows.WithTagName("json"))
+	// Values of other types are converted like the reflection path does
+	flat["port"] = "9090"
+	flat["limits.max_conns"] = 20.0
+
+	var expected, actual Config
+	assert.NoError(t, bellows.ExpandInto(flat, &expected, bellows.WithTagName("json"), reflectionOnly))
+	assert.NoError(t, bellows.ExpandInto(flat, &actual, bellows.WithTagName("json")))
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, 9090, actual.Port)
+	assert.Equal(t, 20, actual.Limits.MaxConns)
+	assert.Equal(t, "", actual.Secret)
+}
+
+func TestGeneratedExpandInlineMap(t *testing.T) {
+	input := Trace{Name: "a", Audit: Audit{CreatedBy: "ci"}, Extra: map[string]string{"k": "v"}}
+	flat := bellows.Flatten(input, bellows.WithTagName("json"))
+	assert.Equal(t, map[string]interface{}{"name": "a", "created_by": "ci", "k": "v"}, flat)
+
+	var expected, actual Trace
+	assert.NoError(t, bellows.ExpandInto(flat, &expected, bellows.WithTagName("json"), reflectionOnly))
+	assert.NoError(t, bellows.ExpandInto(flat, &actual, bellows.WithTagName("json")))
+	assert.Equal(t, input, expected)
+	assert.Equal(t, expected, actual)
+}
+
+func TestGeneratedIgnoredWithOtherTag(t *testing.T) {
+	flat := bellows.Flatten(Server{Host: "a"})
+	assert.Equal(t, map[string]interface{}{"Host": "a", "Port": uint16(0)}, flat)
+}
+
+func TestGeneratedSkipsCyclicTypes(t *testing.T) {
+	var _ bellows.MapExpander = &Node{}
+	_, ok := interface{}(Node{}).(bellows.MapFlattener)
+	assert.False(t, ok)
+
+	n := &Node{Name: "a"}
+	n.Next = n
+	_, err := bellows.FlattenE(n, bellows.WithTagName("json"))
+	var cycleErr *bellows.CycleError
+	assert.ErrorAs(t, err, &cycleErr)
+
+	var actual Node
+	flat := map[string]interface{}{"name": "a", "next.name": "b"}
+	assert.NoError(t, bellows.ExpandInto(flat, &actual, bellows.WithTagName("json")))
+	assert.Equal(t, Node{Name: "a", Next: &Node{Name: "b"}}, actual)
+}
+
+func TestGeneratedFlattenEMatchesFlatten(t *testing.T) {
+	flat, err := bellows.FlattenE(config, bellows.WithTagName("json"))
+	assert.NoError(t, err)
+	assert.Equal(t, bellows.Flatten(config, bellows.WithTagName("json")), flat)
+}
+
+func BenchmarkFlattenGenerated(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = bellows.Flatten(config, bellows.WithTagName("json"))
+	}
+}
+
+func BenchmarkFlattenReflection(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = bellows.Flatten(config, bellows.WithTagName("json"), reflectionOnly)
+	}
+}
+
+var servers = []Server{{Host: "a", Port: 1}, {Host: "b", Port: 2}, {Host: "c", Port: 3}}
+
+func BenchmarkFlattenGeneratedServers(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = bellows.Flatten(servers, bellows.WithTagName("json"))
+	}
+}
+
+func BenchmarkFlattenReflectionServers(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = bellows.Flatten(servers, bellows.WithTagName("json"), reflectionOnly)
+	}
+}
+
+var flatConfig = bellows.Flatten(config, bellows.WithTagName("json"))
+
+func BenchmarkExpandGenerated(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var c Config
+		_ = bellows.ExpandInto(flatConfig, &c, bellows.WithTagName("json"))
+	}
+}
+
+func BenchmarkExpandReflection(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var c Config
+		_ = bellows.ExpandInto(flatConfig, &c, bellows.WithTagName("json"), reflectionOnly)
+	}
+}
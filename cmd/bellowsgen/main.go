@@ -0,0 +1,142 @@
+// Command bellowsgen generates FlattenTo and ExpandFrom methods for struct
+// types, so that bellows can flatten and expand them without reflection.
+//
+// Add a directive next to the types and run go generate:
+//
+//	//go:generate go run github.com/adibaulia/bellows/cmd/bellowsgen -type=Config,Server -tag=json
+//
+// The generated methods implement bellows.MapFlattener and
+// bellows.MapExpander. Flatten, ExpandInto and friends use them when called
+// with default options, apart from WithPrefix and a WithTagName matching
+// -tag, and fall back to reflection otherwise. Basic fields, leaves such as
+// time.Time, the other generated types, and slices of, maps with string keys
+// of and pointers to those are handled directly; everything else is handed to
+// bellows. FlattenE and Walk always use reflection.
+//
+// FlattenTo cannot detect cycles, so it is only generated for types whose
+// values cannot refer back to themselves: types that do not refer to
+// themselves and have no interface fields. Other types only get ExpandFrom.
+//
+// The package-level helpers are named after the output file, so a package can
+// have several outputs, each generating different types.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("bellowsgen: ")
+	typeNames := flag.String("type", "", "comma-separated list of struct type names; required")
+	tagName := flag.String("tag", "", "struct tag that keys fields, as passed to bellows.WithTagName")
+	output := flag.String("output", "bellows_gen.go", "output file name, relative to the package directory")
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	pkg, err := loadPackage(dir, *output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	g := newGenerator(pkg, *tagName, helperPrefix(*output))
+	src, err := g.generate(strings.Split(*typeNames, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, w := range g.warnings {
+		log.Print(w)
+	}
+	if err := os.WriteFile(filepath.Join(dir, *output), src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// pkg is the type-checked package the types are looked up in.
+type pkg struct {
+	types *types.Package
+	// errs holds the type errors found, which are only reported when they
+	// leave a field's type unknown. The previous output is not loaded, so
+	// code using its methods does not type-check.
+	errs []error
+}
+
+// loadPackage type-checks the package in dir from the files go build would
+// use, skipping the previous output.
+func loadPackage(dir, output string) (*pkg, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range append(bp.GoFiles, bp.CgoFiles...) {
+		if name == filepath.Clean(output) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(bp.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	p := &pkg{}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(err error) { p.errs = append(p.errs, err) },
+	}
+	p.types, _ = conf.Check(bp.Name, fset, files, nil)
+	return p, nil
+}
+
+// err returns the first type error, for fields whose type is unknown.
+func (p *pkg) err() error {
+	if len(p.errs) == 0 {
+		return errors.New("unknown type")
+	}
+	return p.errs[0]
+}
+
+// helperPrefix derives the names of the package-level helpers from the output
+// file name, e.g. "bellowsGen" for bellows_gen.go and "bellowsConfigGen" for
+// config_gen.go.
+func helperPrefix(output string) string {
+	base := strings.TrimSuffix(filepath.Base(output), ".go")
+	words := strings.FieldsFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 || !strings.EqualFold(words[0], "bellows") {
+		words = append([]string{"bellows"}, words...)
+	}
+	var b strings.Builder
+	b.WriteString("bellows")
+	for _, w := range words[1:] {
+		r, size := utf8.DecodeRuneInString(w)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(w[size:])
+	}
+	return b.String()
+}
@@ -0,0 +1,333 @@
+package bellows
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Coercion selects the rules Expand uses to turn string leaves, such as
+// values read from environment variables, query strings or CSV, into bools,
+// numbers and nil.
+type Coercion int
+
+const (
+	// CoerceNone keeps string leaves as they are.
+	CoerceNone Coercion = iota
+	// CoerceYAML follows the YAML 1.2 core schema: "true", "True" and
+	// "TRUE" and their false forms are bools, "null", "Null", "NULL", "~"
+	// and "" are nil, decimal, "0o" octal and "0x" hex integers are ints,
+	// and decimals, exponents, ".inf" and ".nan" are float64.
+	CoerceYAML
+	// CoerceJSON follows JSON literals: "true" and "false" are bools,
+	// "null" is nil, and numbers are ints, or float64 when they have a
+	// fraction or an exponent.
+	CoerceJSON
+)
+
+// WithCoercion makes Expand convert string leaves that look like bools,
+// numbers or null under rules into those types, so "8080" becomes 8080.
+// Integers that do not fit in an int stay strings. ExpandInto ignores the
+// rules, as it converts strings to the types of the destination already.
+func WithCoercion(rules Coercion) Option {
+	return func(o *Options) {
+		o.Coercion = rules
+	}
+}
+
+// ScalarType is the type WithScalarSchema requires of a leaf.
+type ScalarType int
+
+const (
+	// ScalarString keeps the leaf a string, whatever it looks like.
+	ScalarString ScalarType = iota
+	// ScalarBool parses the leaf with strconv.ParseBool.
+	ScalarBool
+	// ScalarInt parses the leaf as a decimal, "0o" octal or "0x" hex int.
+	ScalarInt
+	// ScalarFloat parses the leaf with strconv.ParseFloat.
+	ScalarFloat
+)
+
+func (t ScalarType) String() string {
+	switch t {
+	case ScalarString:
+		return "string"
+	case ScalarBool:
+		return "bool"
+	case ScalarInt:
+		return "int"
+	case ScalarFloat:
+		return "float"
+	}
+	return "ScalarType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// WithScalarSchema overrides WithCoercion for the string leaves of keys
+// matching the patterns of schema, see WithInclude for the syntax, e.g.
+// {"zip": ScalarString, "services.[*].port": ScalarInt}. A leaf that cannot
+// be parsed as its type is dropped and ExpandE reports a *CoercionError.
+// When several patterns match a key, the one with the fewest wildcards wins,
+// then the one with the most segments.
+func WithScalarSchema(schema map[string]ScalarType) Option {
+	return func(o *Options) {
+		if o.ScalarSchema == nil {
+			o.ScalarSchema = make(map[string]ScalarType, len(schema))
+		}
+		for pattern, t := range schema {
+			o.ScalarSchema[pattern] = t
+		}
+	}
+}
+
+// schemaRule is a compiled WithScalarSchema pattern.
+type schemaRule struct {
+	source    string
+	pattern   []segment
+	wildcards int
+	t         ScalarType
+}
+
+func (o *Options) compileSchema() []schemaRule {
+	if len(o.ScalarSchema) == 0 {
+		return nil
+	}
+	rules := make([]schemaRule, 0, len(o.ScalarSchema))
+	for source, t := range o.ScalarSchema {
+		rule := schemaRule{source: source, pattern: o.parsePattern(source), t: t}
+		for _, seg := range rule.pattern {
+			switch seg.kind {
+			case anySegment, anyIndexSegment, anyPathSegment:
+				rule.wildcards++
+			}
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if a.wildcards != b.wildcards {
+			return a.wildcards < b.wildcards
+		}
+		if len(a.pattern) != len(b.pattern) {
+			return len(a.pattern) > len(b.pattern)
+		}
+		return naturalLess(a.source, b.source)
+	})
+	return rules
+}
+
+// coerces reports whether Expand converts string leaves at all.
+func (o *Options) coerces() bool {
+	return o.Coercion != CoerceNone || len(o.schema) > 0
+}
+
+// coerce converts value, stored at key with the given path, according to
+// WithScalarSchema or else WithCoercion.
+func (o *Options) coerce(key string, path []segment, value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	for _, rule := range o.schema {
+		if !matchPath(rule.pattern, path, matchExact) {
+			continue
+		}
+		if v, ok := parseScalar(s, rule.t); ok {
+			return v, nil
+		}
+		return nil, &CoercionError{Key: key, Value: s, Type: rule.t}
+	}
+	switch o.Coercion {
+	case CoerceYAML:
+		return coerceYAML(s), nil
+	case CoerceJSON:
+		return coerceJSON(s), nil
+	}
+	return s, nil
+}
+
+func parseScalar(s string, t ScalarType) (interface{}, bool) {
+	switch t {
+	case ScalarString:
+		return s, true
+	case ScalarBool:
+		b, err := strconv.ParseBool(s)
+		return b, err == nil
+	case ScalarInt:
+		return parseIntLiteral(s)
+	case ScalarFloat:
+		f, err := strconv.ParseFloat(s, 64)
+		return f, err == nil
+	}
+	return nil, false
+}
+
+func parseInt(s string, base int) (interface{}, bool) {
+	i, err := strconv.ParseInt(s, base, strconv.IntSize)
+	return int(i), err == nil
+}
+
+// parseIntLiteral parses a decimal, "0o" octal or "0x" hex int with an
+// optional sign.
+func parseIntLiteral(s string) (interface{}, bool) {
+	sign, digits := "", s
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		sign, digits = s[:1], s[1:]
+	}
+	base := 10
+	if len(digits) > 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'o', 'O':
+			base, digits = 8, digits[2:]
+		case 'x', 'X':
+			base, digits = 16, digits[2:]
+		}
+	}
+	if digits == "" || digits[0] == '-' || digits[0] == '+' {
+		return nil, false
+	}
+	return parseInt(sign+digits, base)
+}
+
+// parseUnsigned is like parseInt for digits without a sign.
+func parseUnsigned(digits string, base int) (interface{}, bool) {
+	if digits == "" || digits[0] == '-' || digits[0] == '+' {
+		return nil, false
+	}
+	return parseInt(digits, base)
+}
+
+// coerceYAML resolves a plain scalar with the YAML 1.2 core schema.
+func coerceYAML(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN()
+	}
+	if len(s) > 2 && s[0] == '0' && (s[1] == 'o' || s[1] == 'x') {
+		base := 8
+		if s[1] == 'x' {
+			base = 16
+		}
+		if v, ok := parseUnsigned(s[2:], base); ok {
+			return v
+		}
+		return s
+	}
+
+	// [-+]? ( \.[0-9]+ | [0-9]+ ( \.[0-9]* )? ) ( [eE] [-+]? [0-9]+ )?
+	i := 0
+	if i < len(s) && (s[i] == '-' || s[i] == '+') {
+		i++
+	}
+	intDigits := scanDigits(s, i)
+	i += intDigits
+	fraction := i < len(s) && s[i] == '.'
+	if fraction {
+		i++
+		n := scanDigits(s, i)
+		if intDigits == 0 && n == 0 {
+			return s
+		}
+		i += n
+	} else if intDigits == 0 {
+		return s
+	}
+	exponent, ok := scanExponent(s, i)
+	if !ok {
+		return s
+	}
+	if !fraction && !exponent {
+		if v, ok := parseInt(s, 10); ok {
+			return v
+		}
+		return s
+	}
+	return parseFloat(s)
+}
+
+// coerceJSON resolves s as a JSON literal.
+func coerceJSON(s string) interface{} {
+	switch s {
+	case "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	// -? ( 0 | [1-9][0-9]* ) ( \.[0-9]+ )? ( [eE] [-+]? [0-9]+ )?
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	n := scanDigits(s, i)
+	if n == 0 || n > 1 && s[i] == '0' {
+		return s
+	}
+	i += n
+	fraction := i < len(s) && s[i] == '.'
+	if fraction {
+		i++
+		n := scanDigits(s, i)
+		if n == 0 {
+			return s
+		}
+		i += n
+	}
+	exponent, ok := scanExponent(s, i)
+	if !ok {
+		return s
+	}
+	if !fraction && !exponent {
+		if v, ok := parseInt(s, 10); ok {
+			return v
+		}
+		return s
+	}
+	return parseFloat(s)
+}
+
+// scanExponent reports whether s[i:] is an exponent, and whether it is
+// either that or empty.
+func scanExponent(s string, i int) (exponent, ok bool) {
+	if i == len(s) {
+		return false, true
+	}
+	if s[i] != 'e' && s[i] != 'E' {
+		return false, false
+	}
+	i++
+	if i < len(s) && (s[i] == '-' || s[i] == '+') {
+		i++
+	}
+	n := scanDigits(s, i)
+	return true, n > 0 && i+n == len(s)
+}
+
+func scanDigits(s string, i int) int {
+	n := 0
+	for i+n < len(s) && isDigit(s[i+n]) {
+		n++
+	}
+	return n
+}
+
+// parseFloat returns s as a float64, or s itself when it is out of range.
+func parseFloat(s string) interface{} {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s
+	}
+	return f
+}
@@ -0,0 +1,129 @@
+package bellows
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoerceYAML(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{"true", true}, {"False", false}, {"TRUE", true},
+		{"yes", "yes"}, {"tRUE", "tRUE"},
+		{"null", nil}, {"~", nil}, {"", nil}, {"nil", "nil"},
+		{"8080", 8080}, {"-17", -17}, {"+3", 3}, {"017", 17},
+		{"0o17", 15}, {"0x1F", 31}, {"0x", "0x"}, {"0o8", "0o8"}, {"0x-1", "0x-1"},
+		{"1_000", "1_000"}, {"99999999999999999999", "99999999999999999999"},
+		{"1.5", 1.5}, {"-.5", -0.5}, {"1.", 1.0}, {"1e3", 1000.0}, {"2.5E-1", 0.25},
+		{".", "."}, {"e3", "e3"}, {"1e", "1e"}, {"1.2.3", "1.2.3"},
+		{".inf", math.Inf(1)}, {"-.Inf", math.Inf(-1)}, {"inf", "inf"},
+		{"8080/tcp", "8080/tcp"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, coerceYAML(tt.in), tt.in)
+	}
+	nan, _ := coerceYAML(".NaN").(float64)
+	assert.True(t, math.IsNaN(nan))
+}
+
+func TestCoerceJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{"true", true}, {"True", "True"}, {"null", nil}, {"~", "~"}, {"", ""},
+		{"8080", 8080}, {"-17", -17}, {"+3", "+3"}, {"0", 0}, {"017", "017"},
+		{"0x1F", "0x1F"}, {"1.5", 1.5}, {"-0.5e2", -50.0}, {"1.", "1."}, {".5", ".5"},
+		{"1e400", "1e400"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, coerceJSON(tt.in), tt.in)
+	}
+}
+
+func TestExpandCoercion(t *testing.T) {
+	input := map[string]interface{}{
+		"server.port":    "8080",
+		"server.debug":   "true",
+		"server.ratio":   "0.75",
+		"server.name":    "api",
+		"server.zip":     "01234",
+		"server.workers": 4,
+		"tags.[0]":       "null",
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"server": map[string]interface{}{
+			"port": 8080, "debug": true, "ratio": 0.75, "name": "api", "zip": 1234, "workers": 4,
+		},
+		"tags": []interface{}{nil},
+	}, Expand(input, WithCoercion(CoerceYAML)))
+
+	assert.Equal(t, "01234", Expand(input, WithCoercion(CoerceJSON)).(map[string]interface{})["server"].(map[string]interface{})["zip"])
+	assert.Equal(t, "8080", Expand(input).(map[string]interface{})["server"].(map[string]interface{})["port"])
+}
+
+func TestExpandScalarSchema(t *testing.T) {
+	input := map[string]interface{}{
+		"server.port":          "8080",
+		"server.zip":           "01234",
+		"server.debug":         "1",
+		"services.[0].port":    "0x50",
+		"services.[1].port":    "443",
+		"services.[1].version": "2",
+	}
+	schema := map[string]ScalarType{
+		"**.zip":            ScalarString,
+		"server.debug":      ScalarBool,
+		"services.[*].port": ScalarInt,
+		"services.[1].*":    ScalarFloat,
+	}
+
+	result, err := ExpandE(input, WithCoercion(CoerceYAML), WithScalarSchema(schema))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"server": map[string]interface{}{"port": 8080, "zip": "01234", "debug": true},
+		"services": []interface{}{
+			map[string]interface{}{"port": 80},
+			map[string]interface{}{"port": 443, "version": 2.0},
+		},
+	}, result)
+
+	// The schema applies without WithCoercion too
+	result, err = ExpandE(input, WithScalarSchema(map[string]ScalarType{"server.port": ScalarInt}))
+	assert.NoError(t, err)
+	assert.Equal(t, 8080, result.(map[string]interface{})["server"].(map[string]interface{})["port"])
+	assert.Equal(t, "1", result.(map[string]interface{})["server"].(map[string]interface{})["debug"])
+}
+
+func TestExpandScalarSchemaError(t *testing.T) {
+	input := map[string]interface{}{"server.port": "http", "server.name": "api"}
+
+	_, err := ExpandE(input, WithScalarSchema(map[string]ScalarType{"server.port": ScalarInt}))
+	var coercionErr *CoercionError
+	if assert.True(t, errors.As(err, &coercionErr)) {
+		assert.Equal(t, "server.port", coercionErr.Key)
+		assert.Equal(t, "http", coercionErr.Value)
+		assert.Equal(t, ScalarInt, coercionErr.Type)
+	}
+	assert.EqualError(t, err, `bellows: cannot coerce "http" at key "server.port" to int`)
+
+	result := Expand(input, WithScalarSchema(map[string]ScalarType{"server.port": ScalarInt}))
+	assert.Equal(t, map[string]interface{}{"server": map[string]interface{}{"name": "api"}}, result)
+}
+
+func TestExpandIntoIgnoresCoercion(t *testing.T) {
+	var dst struct {
+		Zip  string
+		Port int
+	}
+	err := ExpandInto(map[string]interface{}{"Zip": "01234", "Port": "8080"}, &dst, WithCoercion(CoerceYAML))
+	assert.NoError(t, err)
+	assert.Equal(t, "01234", dst.Zip)
+	assert.Equal(t, 8080, dst.Port)
+}
@@ -0,0 +1,157 @@
+package bellows
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// Flattenable is implemented by types that choose their own flat keys, like
+// json.Marshaler does for JSON. FlattenBellows calls emit for each key below
+// the value's own key, with subkey "" standing for the value's own key.
+// Emitted values are stored as they are, without being flattened further.
+type Flattenable interface {
+	FlattenBellows(emit func(subkey string, v interface{}))
+}
+
+// Expandable is implemented by pointers to types that read themselves back
+// from the keys their FlattenBellows emitted. ExpandInto passes the keys
+// below the value's own key, with the key itself as "".
+type Expandable interface {
+	ExpandBellows(flat map[string]interface{}) error
+}
+
+var (
+	flattenableType = reflect.TypeOf((*Flattenable)(nil)).Elem()
+	expandableType  = reflect.TypeOf((*Expandable)(nil)).Elem()
+)
+
+// customTypes caches implements checks for Flattenable and Expandable.
+var customTypes sync.Map // customKey -> bool
+
+type customKey struct {
+	t     reflect.Type
+	iface reflect.Type
+}
+
+// maybeHasMethods reports whether t or *t can have methods. Only types
+// declared in a package, and pointers to them, can.
+func maybeHasMethods(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.PkgPath() != ""
+}
+
+// implements is a cached t.Implements(iface).
+func implements(t, iface reflect.Type) bool {
+	if !maybeHasMethods(t) {
+		return false
+	}
+	key := customKey{t: t, iface: iface}
+	if ok, found := customTypes.Load(key); found {
+		return ok.(bool)
+	}
+	ok := t.Implements(iface)
+	customTypes.Store(key, ok)
+	return ok
+}
+
+// flattenable returns v as a Flattenable, using its address for methods
+// with pointer receivers when v is addressable.
+func flattenable(v reflect.Value) (Flattenable, bool) {
+	t := v.Type()
+	if !maybeHasMethods(t) {
+		return nil, false
+	}
+	switch {
+	case implements(t, flattenableType):
+		if t.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, false
+		}
+		return v.Interface().(Flattenable), true
+	case t.Kind() != reflect.Ptr && v.CanAddr() && implements(reflect.PointerTo(t), flattenableType):
+		return v.Addr().Interface().(Flattenable), true
+	}
+	return nil, false
+}
+
+// flattenCustom stores the keys f emits below the current key.
+func (w *walker) flattenCustom(f Flattenable) error {
+	var err error
+	f.FlattenBellows(func(subkey string, v interface{}) {
+		if err != nil {
+			return
+		}
+		n := len(w.buf)
+		if subkey != "" {
+			if n == 0 {
+				w.root = subkey
+			} else if !(w.opts.IndexStyle == IndexBracket && subkey[0] == '[') {
+				w.buf = append(w.buf, w.opts.Sep...)
+			}
+			w.buf = append(w.buf, subkey...)
+		}
+		switch {
+		case subkey == "" || w.opts.filter == nil:
+			err = w.emit(v)
+		case w.opts.filter.keep(w.opts.parsePath(string(w.buf))):
+			err = w.store(v)
+		}
+		w.buf = w.buf[:n]
+	})
+	return err
+}
+
+// expandable returns dst as an Expandable when its address implements it.
+func expandable(dst reflect.Value) (Expandable, bool) {
+	if !dst.CanAddr() || !implements(reflect.PointerTo(dst.Type()), expandableType) {
+		return nil, false
+	}
+	return dst.Addr().Interface().(Expandable), true
+}
+
+// expandCustom passes the expanded subtree src back to e as the flat keys it
+// was built from.
+func expandCustom(e Expandable, src interface{}, path string, opts *Options) error {
+	flat := make(map[string]interface{})
+	opts.flattenTree(src, "", flat)
+	if err := e.ExpandBellows(flat); err != nil {
+		return fmt.Errorf("bellows: cannot expand %q: %w", path, err)
+	}
+	return nil
+}
+
+// flattenTree is the inverse of Expand: it stores the leaves of v, as built
+// by Expand, in flat below prefix.
+func (o *Options) flattenTree(v interface{}, prefix string, flat map[string]interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			o.flattenTree(child, joinPath(prefix, o.escapeKey(k), o.Sep), flat)
+		}
+	case []interface{}:
+		for i, child := range v {
+			o.flattenTree(child, o.subIndexKey(prefix, i), flat)
+		}
+	case map[int]interface{}:
+		for i, child := range v {
+			o.flattenTree(child, o.subIndexKey(prefix, i), flat)
+		}
+	default:
+		flat[prefix] = v
+	}
+}
+
+// subIndexKey is like indexKey, but starts relative keys with the index
+// itself, e.g. "[0]" rather than ".[0]".
+func (o *Options) subIndexKey(prefix string, i int) string {
+	if prefix != "" {
+		return o.indexKey(prefix, i)
+	}
+	if o.IndexStyle == IndexDot {
+		return strconv.Itoa(i)
+	}
+	return "[" + strconv.Itoa(i) + "]"
+}
@@ -0,0 +1,118 @@
+package bellows
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// money flattens to its parts instead of its fields.
+type money struct {
+	cents    int64
+	currency string
+}
+
+func (m money) FlattenBellows(emit func(string, interface{})) {
+	emit("amount", float64(m.cents)/100)
+	emit("currency", m.currency)
+}
+
+func (m *money) ExpandBellows(flat map[string]interface{}) error {
+	amount, ok := flat["amount"].(float64)
+	if !ok {
+		return fmt.Errorf("missing amount")
+	}
+	m.cents = int64(amount * 100)
+	m.currency, _ = flat["currency"].(string)
+	return nil
+}
+
+// geoPoint flattens to a single "lat,lng" value at its own key.
+type geoPoint struct {
+	Lat, Lng float64
+}
+
+func (p *geoPoint) FlattenBellows(emit func(string, interface{})) {
+	emit("", fmt.Sprintf("%g,%g", p.Lat, p.Lng))
+}
+
+func (p *geoPoint) ExpandBellows(flat map[string]interface{}) error {
+	_, err := fmt.Sscanf(flat[""].(string), "%g,%g", &p.Lat, &p.Lng)
+	return err
+}
+
+type order struct {
+	Total    money
+	Location *geoPoint
+	Stops    []geoPoint
+}
+
+func TestFlattenFlattenable(t *testing.T) {
+	input := order{
+		Total:    money{cents: 1250, currency: "EUR"},
+		Location: &geoPoint{Lat: 1.5, Lng: 2},
+		Stops:    []geoPoint{{Lat: 3, Lng: 4}},
+	}
+	expected := map[string]interface{}{
+		"Total.amount":   12.5,
+		"Total.currency": "EUR",
+		"Location":       "1.5,2",
+		"Stops.[0]":      "3,4",
+	}
+	assert.Equal(t, expected, Flatten(input))
+	assert.Equal(t, map[string]interface{}{"amount": 12.5, "currency": "EUR"}, Flatten(money{cents: 1250, currency: "EUR"}))
+	assert.Equal(t, map[string]interface{}{"Total/amount": 12.5, "Total/currency": "EUR"},
+		Flatten(input, WithSep("/"), WithExclude("Location", "Stops")))
+}
+
+func TestFlattenFlattenableOptions(t *testing.T) {
+	input := order{Total: money{cents: 100, currency: "USD"}, Stops: []geoPoint{{}}}
+	assert.Equal(t, map[string]interface{}{"Total.amount": 1.0}, Flatten(input, WithInclude("Total.amount")))
+	assert.Equal(t, map[string]interface{}{
+		"Total.amount":   1.0,
+		"Total.currency": "USD",
+		"Location":       nil,
+		"Stops[0]":       "0,0",
+	}, Flatten(input, WithIndexStyle(IndexBracket)))
+
+	var keys []string
+	err := Walk(input, func(key string, v interface{}) error {
+		keys = append(keys, key)
+		return errStopWalk
+	})
+	assert.Equal(t, errStopWalk, err)
+	assert.Len(t, keys, 1)
+}
+
+// pair flattens to an item and a value at its own key, in that order.
+type pair struct{}
+
+func (pair) FlattenBellows(emit func(string, interface{})) {
+	emit("[0]", "first")
+	emit("", "self")
+}
+
+func TestFlattenFlattenableBracketSubkey(t *testing.T) {
+	input := struct{ Abc pair }{}
+	assert.Equal(t, map[string]interface{}{"Abc[0]": "first", "Abc": "self"}, Flatten(input, WithIndexStyle(IndexBracket)))
+	assert.Equal(t, map[string]interface{}{"[0]": "first"}, Flatten(pair{}, WithIndexStyle(IndexBracket)))
+}
+
+func TestExpandIntoExpandable(t *testing.T) {
+	input := order{
+		Total:    money{cents: 1250, currency: "EUR"},
+		Location: &geoPoint{Lat: 1.5, Lng: 2},
+		Stops:    []geoPoint{{Lat: 3, Lng: 4}, {Lat: 5, Lng: 6}},
+	}
+	var output order
+	assert.NoError(t, ExpandInto(Flatten(input), &output))
+	assert.Equal(t, input, output)
+
+	var m money
+	assert.NoError(t, ExpandInto(map[string]interface{}{"amount": 1.0, "currency": "USD"}, &m))
+	assert.Equal(t, money{cents: 100, currency: "USD"}, m)
+
+	err := ExpandInto(map[string]interface{}{"Total.currency": "USD"}, &output)
+	assert.EqualError(t, err, `bellows: cannot expand "Total": missing amount`)
+}
@@ -0,0 +1,93 @@
+package bellows
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConflictError reports a flat key that needs a different shape at Path than
+// the one an earlier key already gave it, e.g. "a" holding a scalar while "a.b"
+// needs a map.
+type ConflictError struct {
+	// Path is the contested node, without any trailing separator.
+	Path string
+	// Existing is the flat key that shaped the node first.
+	Existing string
+	// Incoming is the flat key that was rejected.
+	Incoming string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("bellows: key %q conflicts with key %q at path %q", e.Incoming, e.Existing, e.Path)
+}
+
+// ConflictErrors lists every conflict found during a single expansion. It
+// unwraps to the individual *ConflictError values, so errors.As works on it.
+type ConflictErrors []*ConflictError
+
+func (e ConflictErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e ConflictErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// CycleError reports a value that refers back to one of its ancestors.
+type CycleError struct {
+	// Path is where the cycle was found.
+	Path string
+	// Target is the path of the ancestor it refers back to.
+	Target string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("bellows: cycle at path %q refers back to path %q", e.Path, e.Target)
+}
+
+// DepthError reports a path nested deeper than the limit set by WithMaxDepth.
+type DepthError struct {
+	// Path is the flattened path, or the flat key being expanded.
+	Path     string
+	MaxDepth int
+}
+
+func (e *DepthError) Error() string {
+	return fmt.Sprintf("bellows: path %q exceeds max depth %d", e.Path, e.MaxDepth)
+}
+
+// IndexError reports a flat key rejected by WithStrictIndex, WithMaxIndex or
+// WithMaxSparsity.
+type IndexError struct {
+	// Path is the offending segment and everything before it.
+	Path string
+	// Key is the flat key being expanded.
+	Key string
+	// Reason describes what is wrong with the index.
+	Reason string
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("bellows: invalid index at path %q of key %q: %s", e.Path, e.Key, e.Reason)
+}
+
+// CoercionError reports a string leaf that WithScalarSchema requires to be of
+// a type it cannot be parsed as.
+type CoercionError struct {
+	// Key is the flat key being expanded.
+	Key   string
+	Value string
+	Type  ScalarType
+}
+
+func (e *CoercionError) Error() string {
+	return fmt.Sprintf("bellows: cannot coerce %q at key %q to %s", e.Value, e.Key, e.Type)
+}
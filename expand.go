@@ -1,90 +1,325 @@
 package bellows
 
 import (
-	"regexp"
-	"strconv"
-	"strings"
+	"errors"
+	"sort"
 )
 
-var (
-	arrayIndexRegexp = regexp.MustCompile(`\[[^\]]*\]`)
-)
+// Expand turns a flat map into nested maps and slices. Keys are processed in
+// natural order (see sortPaths), so identical input always gives identical
+// output; a key whose path conflicts with an earlier key is dropped unless
+// WithConflictPolicy says otherwise.
+func Expand(flatMap map[string]interface{}, opts ...Option) interface{} {
+	options := newOptions(opts)
+	root, _ := expand(flatMap, options, true)
+	if root == nil {
+		return nil
+	}
+	return root.build(options)
+}
 
-func Expand(flatMap map[string]interface{}, opts ...option) interface{} {
-	options := &bellowsOptions{sep: "."}
-	for _, opt := range opts {
-		opt(options)
+// ExpandE is like Expand, but reports keys it cannot place. Keys that disagree
+// on the shape of a path, such as "a" and "a.b", or "a.[0]" and "a.x", are
+// reported in a ConflictErrors unless WithConflictPolicy resolves them, keys
+// deeper than WithMaxDepth in a *DepthError, indexes rejected by
+// WithStrictIndex, WithMaxIndex or WithMaxSparsity in an *IndexError and
+// leaves that do not fit WithScalarSchema in a *CoercionError.
+func ExpandE(flatMap map[string]interface{}, opts ...Option) (interface{}, error) {
+	options := newOptions(opts)
+	root, err := expand(flatMap, options, true)
+	if err != nil {
+		return nil, err
 	}
-	var dst interface{}
-	for path, value := range flatMap {
-		parts := strings.Split(path, options.sep)
-		dst = put(dst, parts, value)
+	if root == nil {
+		return nil, nil
 	}
-	return dst
+	return root.build(options), nil
 }
 
-func put(dst interface{}, path []string, value interface{}) interface{} {
-	if len(path) == 0 {
-		return value
-	}
-
-	p := path[0]
-	index, isArray := getArrayIndex(p)
-	if isArray {
-		if dst == nil {
-			dst = make([]interface{}, 0, 3)
-		}
-		if arr, ok := dst.([]interface{}); ok {
-			i := len(arr)
-			if i == index {
-				arr = append(arr, put(nil, path[1:], value))
-			} else if i < index {
-				toInsert := make([]interface{}, index-i)
-				newItem := put(nil, path[1:], value)
-				switch newItem.(type) {
-				case []interface{}:
-					for i := range toInsert {
-						toInsert[i] = make([]interface{}, 0)
-					}
-				case map[string]interface{}:
-					for i := range toInsert {
-						toInsert[i] = make(map[string]interface{}, 0)
-					}
-				}
-				arr = append(arr[:i], append(toInsert, newItem)...)
-			} else {
-				arr[index] = put(arr[index], path[1:], value)
-			}
+// expand builds the tree of flatMap, converting string leaves as configured by
+// WithCoercion and WithScalarSchema if coerce is set.
+func expand(flatMap map[string]interface{}, opts *Options, coerce bool) (*node, error) {
+	coerce = coerce && opts.coerces()
+	keys := make([]string, 0, len(flatMap))
+	for key := range flatMap {
+		keys = append(keys, key)
+	}
+	sortPaths(keys)
 
-			dst = arr
+	e := &expansion{opts: opts}
+	var root *node
+	var errs []error
+	for _, key := range keys {
+		path := opts.parsePath(key)
+		if opts.filter != nil && !opts.filter.keep(path) {
+			continue
+		}
+		if opts.MaxDepth > 0 && len(path) > opts.MaxDepth {
+			errs = append(errs, &DepthError{Path: key, MaxDepth: opts.MaxDepth})
+			continue
 		}
-	} else {
-		if dst == nil {
-			dst = make(map[string]interface{}, 3)
+		if err := opts.checkIndexes(key, path); err != nil {
+			errs = append(errs, err)
+			continue
 		}
-		if m, ok := dst.(map[string]interface{}); ok {
-			if val, ok := m[p]; ok {
-				m[p] = put(val, path[1:], value)
-			} else {
-				m[p] = put(nil, path[1:], value)
+		value := flatMap[key]
+		if coerce {
+			var err error
+			if value, err = opts.coerce(key, path, value); err != nil {
+				errs = append(errs, err)
+				continue
 			}
 		}
+		root = e.insert(root, path, 0, key, value)
+	}
+	if opts.MaxSparsity > 0 && root != nil {
+		root = e.checkSparsity(root)
+		sort.Slice(e.sparse, func(i, j int) bool {
+			return naturalLess(e.sparse[i].Path, e.sparse[j].Path)
+		})
+		for _, err := range e.sparse {
+			errs = append(errs, err)
+		}
 	}
+	if len(e.conflicts) > 0 {
+		errs = append(errs, e.conflicts)
+	}
+	if len(errs) == 1 {
+		return root, errs[0]
+	}
+	return root, errors.Join(errs...)
+}
 
-	return dst
+// sortPaths sorts keys in natural order, comparing runs of digits by their
+// numeric value so that "a.[2]" comes before "a.[10]".
+func sortPaths(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		return naturalLess(keys[i], keys[j])
+	})
 }
 
-func getArrayIndex(part string) (int, bool) {
-	index := arrayIndexRegexp.FindString(part)
-	if index == "" {
-		return 0, false
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			for si < i-1 && a[si] == '0' {
+				si++
+			}
+			for sj < j-1 && b[sj] == '0' {
+				sj++
+			}
+			na, nb := a[si:i], b[sj:j]
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i++
+		j++
+	}
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
 	}
+	// Only leading zeros differ, fall back to byte order to stay total
+	return a < b
+}
 
-	// Remove the brackets from the matched string [123] -> 123
-	i, err := strconv.Atoi(index[1 : len(index)-1])
-	if err != nil {
-		return 0, false
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type nodeKind uint8
+
+const (
+	leafNode nodeKind = iota
+	mapNode
+	sliceNode
+)
+
+// node is one path of an expansion in progress. Keeping the shape and the
+// key that produced it lets conflicts be detected and reported.
+type node struct {
+	kind   nodeKind
+	key    string
+	value  interface{}
+	fields map[string]*node
+	items  map[int]*node
+	// size is one past the highest index of a slice node, kept up to date
+	// so appends and build do not have to scan items. lastKey is the key
+	// that set it, and lastPath that key up to the index.
+	size     int
+	lastKey  string
+	lastPath string
+}
+
+type expansion struct {
+	opts      *Options
+	conflicts ConflictErrors
+	sparse    []*IndexError
+}
+
+// insert stores value under path[depth:] below n and returns the node that
+// should take n's place.
+func (e *expansion) insert(n *node, path []segment, depth int, key string, value interface{}) *node {
+	if depth == len(path) {
+		leaf := newLeaf(key, value)
+		switch {
+		case n == nil:
+			return leaf
+		case n.kind == leaf.kind && leaf.kind != leafNode:
+			// An empty container merges into the existing one
+			return n
+		case e.keepExisting(n, leaf.kind, path, depth, key):
+			return n
+		}
+		return leaf
 	}
 
-	return i, true
+	seg := path[depth]
+	kind := sliceNode
+	if seg.kind == keySegment {
+		kind = mapNode
+	}
+	if n == nil {
+		n = &node{kind: kind, key: key}
+	} else if n.kind != kind {
+		if e.keepExisting(n, kind, path, depth, key) {
+			return n
+		}
+		n = &node{kind: kind, key: key}
+	}
+
+	switch seg.kind {
+	case keySegment:
+		if n.fields == nil {
+			n.fields = make(map[string]*node, 3)
+		}
+		n.fields[seg.name] = e.insert(n.fields[seg.name], path, depth+1, key, value)
+	default:
+		if n.items == nil {
+			n.items = make(map[int]*node, 3)
+		}
+		index := seg.index
+		if seg.kind == appendSegment {
+			index = n.size
+		}
+		if index >= n.size {
+			n.size = index + 1
+			n.lastKey, n.lastPath = key, key[:seg.end]
+		}
+		n.items[index] = e.insert(n.items[index], path, depth+1, key, value)
+	}
+	return n
+}
+
+// newLeaf returns the node for value stored at key. Empty maps and slices, as
+// written by WithEmptyContainers, become containers that other keys can fill.
+func newLeaf(key string, value interface{}) *node {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return &node{kind: mapNode, key: key}
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return &node{kind: sliceNode, key: key}
+		}
+	}
+	return &node{kind: leafNode, key: key, value: value}
+}
+
+// keepExisting resolves a clash between existing, found at path[:depth], and
+// a node of kind incoming requested by key, reporting whether existing should
+// be kept.
+func (e *expansion) keepExisting(existing *node, incoming nodeKind, path []segment, depth int, key string) bool {
+	existingScalar, incomingScalar := existing.kind == leafNode, incoming == leafNode
+	switch e.opts.ConflictPolicy {
+	case ConflictLastWins:
+		return false
+	case ConflictScalarWins:
+		return existingScalar || !incomingScalar
+	case ConflictContainerWins:
+		return !existingScalar || incomingScalar
+	case ConflictFail:
+		at := ""
+		if depth > 0 {
+			at = key[:path[depth-1].end]
+		}
+		e.conflicts = append(e.conflicts, &ConflictError{
+			Path:     at,
+			Existing: existing.key,
+			Incoming: key,
+		})
+	}
+	return true
+}
+
+func (n *node) build(opts *Options) interface{} {
+	switch n.kind {
+	case leafNode:
+		return n.value
+	case mapNode:
+		m := make(map[string]interface{}, len(n.fields))
+		for k, child := range n.fields {
+			m[k] = child.build(opts)
+		}
+		return m
+	}
+
+	l := n.size
+	if len(n.items) < l {
+		switch opts.SparsePolicy {
+		case SparseIndexMap:
+			m := make(map[int]interface{}, len(n.items))
+			for i, child := range n.items {
+				m[i] = child.build(opts)
+			}
+			return m
+		case SparseCompact:
+			indexes := make([]int, 0, len(n.items))
+			for i := range n.items {
+				indexes = append(indexes, i)
+			}
+			sort.Ints(indexes)
+			arr := make([]interface{}, len(indexes))
+			for j, i := range indexes {
+				arr[j] = n.items[i].build(opts)
+			}
+			return arr
+		}
+	}
+
+	arr := make([]interface{}, l)
+	// Gaps take the shape of the next item after them, unless WithNilGaps
+	var next interface{}
+	for i := l - 1; i >= 0; i-- {
+		if child, ok := n.items[i]; ok {
+			arr[i] = child.build(opts)
+			next = arr[i]
+			continue
+		}
+		if opts.NilGaps {
+			continue
+		}
+		switch next.(type) {
+		case []interface{}:
+			arr[i] = make([]interface{}, 0)
+		case map[string]interface{}:
+			arr[i] = make(map[string]interface{}, 0)
+		}
+	}
+	return arr
 }
@@ -0,0 +1,378 @@
+package bellows
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// ExpandInto expands flatMap and stores the result in the value pointed to by
+// dst. It is the inverse of Flatten for structs: embedded structs are promoted,
+// unexported fields are skipped, struct tags are honored with WithTagName,
+// nested pointers, slices and maps are allocated as needed and scalar values
+// are converted to the field types.
+func ExpandInto(flatMap map[string]interface{}, dst interface{}, opts ...Option) error {
+	return expandInto(flatMap, dst, newOptions(opts))
+}
+
+func expandInto(flatMap map[string]interface{}, dst interface{}, opts *Options) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("bellows: ExpandInto requires a non-nil pointer, got %T", dst)
+	}
+	if e, ok := dst.(Expandable); ok {
+		return e.ExpandBellows(flatMap)
+	}
+	if me, ok := opts.mapExpanderFor(dst); ok {
+		return me.ExpandFrom(flatMap)
+	}
+	root, err := expand(flatMap, opts, false)
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		return nil
+	}
+	return decode(root.build(opts), rv.Elem(), "", opts)
+}
+
+func decode(src interface{}, dst reflect.Value, path string, opts *Options) error {
+	if opts.DecodeHook != nil && path != "" {
+		v, handled, err := opts.DecodeHook(path, src, dst.Type())
+		if err != nil {
+			return fmt.Errorf("bellows: decode hook failed at %q: %w", path, err)
+		}
+		if handled {
+			return decodeValue(v, dst, path, opts)
+		}
+	}
+	return decodeValue(src, dst, path, opts)
+}
+
+func decodeValue(src interface{}, dst reflect.Value, path string, opts *Options) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	if e, ok := expandable(dst); ok {
+		return expandCustom(e, src, path, opts)
+	}
+
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dst.Type()) {
+		dst.Set(sv)
+		return nil
+	}
+
+	if text, ok := src.(string); ok && reflect.PointerTo(dst.Type()).Implements(textUnmarshalerType) {
+		if err := dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+			return fmt.Errorf("bellows: cannot expand %q into %s at %q: %w", text, dst.Type(), path, err)
+		}
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decode(src, dst.Elem(), path, opts)
+	case reflect.Struct:
+		m, ok := src.(map[string]interface{})
+		if !ok {
+			return decodeError(sv, dst, path)
+		}
+		return decodeStruct(m, dst, path, opts)
+	case reflect.Map:
+		if im, ok := src.(map[int]interface{}); ok {
+			return decodeIndexMap(im, dst, path, opts)
+		}
+		m, ok := src.(map[string]interface{})
+		if !ok {
+			return decodeError(sv, dst, path)
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(m)))
+		}
+		keyType, elemType := dst.Type().Key(), dst.Type().Elem()
+		for k, v := range m {
+			elem := reflect.New(elemType).Elem()
+			if err := decode(v, elem, joinPath(path, k, opts.Sep), opts); err != nil {
+				return err
+			}
+			key, err := parseMapKey(k, keyType)
+			if err != nil {
+				return fmt.Errorf("bellows: cannot expand key at %q: %w", joinPath(path, k, opts.Sep), err)
+			}
+			dst.SetMapIndex(key, elem)
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if im, ok := src.(map[int]interface{}); ok {
+			return decodeIndexMap(im, dst, path, opts)
+		}
+		if sv.Kind() != reflect.Slice && sv.Kind() != reflect.Array {
+			return decodeError(sv, dst, path)
+		}
+		l := sv.Len()
+		if dst.Kind() == reflect.Slice {
+			dst.Set(reflect.MakeSlice(dst.Type(), l, l))
+		} else if l > dst.Len() {
+			return fmt.Errorf("bellows: cannot expand %d items into %s at %q", l, dst.Type(), path)
+		}
+		for i := 0; i < l; i++ {
+			if err := decode(sv.Index(i).Interface(), dst.Index(i), opts.indexKey(path, i), opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Flatten stores pointer leaves as-is, so follow them before converting.
+	for sv.Kind() == reflect.Ptr || sv.Kind() == reflect.Interface {
+		if sv.IsNil() {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		sv = sv.Elem()
+	}
+	if sv.Type().AssignableTo(dst.Type()) {
+		dst.Set(sv)
+		return nil
+	}
+	if !convertScalar(sv, dst) {
+		return decodeError(sv, dst, path)
+	}
+	return nil
+}
+
+func decodeStruct(m map[string]interface{}, dst reflect.Value, path string, opts *Options) error {
+	return decodeFields(m, dst, dst.Type(), path, opts)
+}
+
+// decodeFields stores the keys of m in the fields of dst, which is the struct
+// outer or a struct inlined in it.
+func decodeFields(m map[string]interface{}, dst reflect.Value, outer reflect.Type, path string, opts *Options) error {
+	for _, f := range opts.plan(dst.Type()).fields {
+		field := dst.Field(f.index)
+		if f.inline {
+			ft := field.Type()
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			switch ft.Kind() {
+			case reflect.Map:
+				// Inlined maps collect the keys that no field of outer uses
+				rest := make(map[string]interface{})
+				for k, v := range m {
+					if !opts.usesKey(outer, k) {
+						rest[k] = v
+					}
+				}
+				if len(rest) == 0 {
+					continue
+				}
+				if err := decode(rest, field, path, opts); err != nil {
+					return err
+				}
+			case reflect.Struct:
+				// Inlined struct fields are promoted to the parent's level
+				if field.Kind() == reflect.Ptr {
+					if field.IsNil() {
+						field.Set(reflect.New(ft))
+					}
+					field = field.Elem()
+				}
+				if err := decodeFields(m, field, outer, path, opts); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		v, ok := m[f.name]
+		if !ok {
+			continue
+		}
+		if err := decode(v, field, joinPath(path, f.name, opts.Sep), opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usesKey reports whether a field of the struct t, or of a struct inlined in
+// it, is stored at key.
+func (o *Options) usesKey(t reflect.Type, key string) bool {
+	for _, f := range o.plan(t).fields {
+		if !f.inline {
+			if f.name == key {
+				return true
+			}
+			continue
+		}
+		ft := t.Field(f.index).Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && o.usesKey(ft, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeIndexMap stores a sparse slice built with SparseIndexMap in a map,
+// slice or array, leaving the missing indexes of slices and arrays zero.
+func decodeIndexMap(m map[int]interface{}, dst reflect.Value, path string, opts *Options) error {
+	if dst.Kind() == reflect.Map {
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(m)))
+		}
+		keyType, elemType := dst.Type().Key(), dst.Type().Elem()
+		for i, v := range m {
+			elem := reflect.New(elemType).Elem()
+			if err := decode(v, elem, opts.indexKey(path, i), opts); err != nil {
+				return err
+			}
+			key, err := parseMapKey(strconv.Itoa(i), keyType)
+			if err != nil {
+				return fmt.Errorf("bellows: cannot expand key at %q: %w", opts.indexKey(path, i), err)
+			}
+			dst.SetMapIndex(key, elem)
+		}
+		return nil
+	}
+
+	l := 0
+	for i := range m {
+		if i >= l {
+			l = i + 1
+		}
+	}
+	if dst.Kind() == reflect.Slice {
+		dst.Set(reflect.MakeSlice(dst.Type(), l, l))
+	} else if l > dst.Len() {
+		return fmt.Errorf("bellows: cannot expand %d items into %s at %q", l, dst.Type(), path)
+	}
+	for i, v := range m {
+		if err := decode(v, dst.Index(i), opts.indexKey(path, i), opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func convertScalar(sv, dst reflect.Value) bool {
+	switch dst.Kind() {
+	case reflect.Bool:
+		switch sv.Kind() {
+		case reflect.Bool:
+			dst.SetBool(sv.Bool())
+			return true
+		case reflect.String:
+			b, err := strconv.ParseBool(sv.String())
+			if err != nil {
+				return false
+			}
+			dst.SetBool(b)
+			return true
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch sv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i = sv.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			u := sv.Uint()
+			if u > 1<<63-1 {
+				return false
+			}
+			i = int64(u)
+		case reflect.Float32, reflect.Float64:
+			f := sv.Float()
+			if f != float64(int64(f)) {
+				return false
+			}
+			i = int64(f)
+		case reflect.String:
+			var err error
+			if i, err = strconv.ParseInt(sv.String(), 10, 64); err != nil {
+				return false
+			}
+		default:
+			return false
+		}
+		if dst.OverflowInt(i) {
+			return false
+		}
+		dst.SetInt(i)
+		return true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch sv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if sv.Int() < 0 {
+				return false
+			}
+			u = uint64(sv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			u = sv.Uint()
+		case reflect.Float32, reflect.Float64:
+			f := sv.Float()
+			if f < 0 || f != float64(uint64(f)) {
+				return false
+			}
+			u = uint64(f)
+		case reflect.String:
+			var err error
+			if u, err = strconv.ParseUint(sv.String(), 10, 64); err != nil {
+				return false
+			}
+		default:
+			return false
+		}
+		if dst.OverflowUint(u) {
+			return false
+		}
+		dst.SetUint(u)
+		return true
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch sv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(sv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			f = float64(sv.Uint())
+		case reflect.Float32, reflect.Float64:
+			f = sv.Float()
+		case reflect.String:
+			var err error
+			if f, err = strconv.ParseFloat(sv.String(), 64); err != nil {
+				return false
+			}
+		default:
+			return false
+		}
+		dst.SetFloat(f)
+		return true
+	case reflect.String:
+		if sv.Kind() == reflect.String {
+			dst.SetString(sv.String())
+			return true
+		}
+	}
+	return false
+}
+
+func decodeError(sv, dst reflect.Value, path string) error {
+	return fmt.Errorf("bellows: cannot expand %s into %s at %q", sv.Type(), dst.Type(), path)
+}
+
+func joinPath(path, key, sep string) string {
+	if path == "" {
+		return key
+	}
+	return path + sep + key
+}
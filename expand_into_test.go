@@ -0,0 +1,144 @@
+package bellows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type intoConfig struct {
+	B
+	Name    string
+	Port    uint16
+	Ratio   float64
+	Enabled bool
+	Tags    []string
+	Limits  map[string]int
+	Inner   *Inner
+	Servers []intoServer
+	Extra   interface{}
+	hidden  string
+}
+
+type intoServer struct {
+	Host string
+	Port int
+}
+
+func TestExpandIntoRoundTrip(t *testing.T) {
+	input := intoConfig{
+		B:       B{C: "c", D: 4},
+		Name:    "svc",
+		Port:    8080,
+		Ratio:   0.5,
+		Enabled: true,
+		Tags:    []string{"a", "b"},
+		Limits:  map[string]int{"cpu": 2, "mem": 512},
+		Inner:   &Inner{B: B{C: "inner"}, V: "v"},
+		Servers: []intoServer{{Host: "a", Port: 1}, {Host: "b", Port: 2}},
+		Extra:   "extra",
+	}
+
+	var result intoConfig
+	err := ExpandInto(Flatten(input), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, input, result)
+}
+
+func TestExpandIntoConvertsValues(t *testing.T) {
+	input := map[string]interface{}{
+		"Name":             "svc",
+		"Port":             "8080",
+		"Ratio":            1,
+		"Enabled":          "true",
+		"Servers.[0].Port": 80.0,
+	}
+	var result intoConfig
+	err := ExpandInto(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(8080), result.Port)
+	assert.Equal(t, 1.0, result.Ratio)
+	assert.True(t, result.Enabled)
+	assert.Equal(t, []intoServer{{Port: 80}}, result.Servers)
+}
+
+func TestExpandIntoParsesDecimalStrings(t *testing.T) {
+	// Strings from configs and environment variables are decimal, so leading
+	// zeros do not switch to octal and Go literal syntax is rejected
+	var result intoConfig
+	input := map[string]interface{}{"Port": "0800", "Servers.[0].Port": "010"}
+	assert.NoError(t, ExpandInto(input, &result))
+	assert.Equal(t, uint16(800), result.Port)
+	assert.Equal(t, 10, result.Servers[0].Port)
+
+	for _, port := range []string{"1_000", "0x50", "0o17"} {
+		assert.Error(t, ExpandInto(map[string]interface{}{"Port": port}, &result), port)
+		assert.Error(t, ExpandInto(map[string]interface{}{"Servers.[0].Port": port}, &result), port)
+	}
+}
+
+func TestExpandIntoPointerLeaves(t *testing.T) {
+	type User struct {
+		Name *string
+		Age  int
+	}
+	name := "John"
+	age := 30
+	var result User
+	err := ExpandInto(map[string]interface{}{"Name": &name, "Age": &age}, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, "John", *result.Name)
+	assert.Equal(t, 30, result.Age)
+}
+
+func TestExpandIntoNilPointer(t *testing.T) {
+	result := intoConfig{Inner: &Inner{V: "v"}}
+	err := ExpandInto(map[string]interface{}{"Inner": nil}, &result)
+	assert.NoError(t, err)
+	assert.Nil(t, result.Inner)
+}
+
+func TestExpandIntoErrors(t *testing.T) {
+	var result intoConfig
+	assert.Error(t, ExpandInto(map[string]interface{}{}, result))
+	assert.Error(t, ExpandInto(map[string]interface{}{}, (*intoConfig)(nil)))
+
+	err := ExpandInto(map[string]interface{}{"Port": "http"}, &result)
+	assert.EqualError(t, err, `bellows: cannot expand string into uint16 at "Port"`)
+
+	err = ExpandInto(map[string]interface{}{"Port": 70000}, &result)
+	assert.Error(t, err)
+
+	err = ExpandInto(map[string]interface{}{"Inner.V.x": "y"}, &result)
+	assert.EqualError(t, err, `bellows: cannot expand map[string]interface {} into string at "Inner.V"`)
+}
+
+func TestExpandIntoMap(t *testing.T) {
+	result := map[string]intoServer{}
+	err := ExpandInto(map[string]interface{}{
+		"a.Host": "x",
+		"b.Port": 2,
+	}, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]intoServer{"a": {Host: "x"}, "b": {Port: 2}}, result)
+}
+
+func TestExpandIntoSparseIndexMap(t *testing.T) {
+	type Target struct {
+		List  []string
+		ByIdx map[int]string
+	}
+	input := map[string]interface{}{
+		"List.[0]":  "a",
+		"List.[2]":  "c",
+		"ByIdx.[1]": "x",
+		"ByIdx.[5]": "y",
+	}
+	var target Target
+	err := ExpandInto(input, &target, WithSparsePolicy(SparseIndexMap))
+	assert.NoError(t, err)
+	assert.Equal(t, Target{
+		List:  []string{"a", "", "c"},
+		ByIdx: map[int]string{1: "x", 5: "y"},
+	}, target)
+}
@@ -198,7 +198,7 @@ func TestExpandArrayWithLargeGapsAndMixedTypes(t *testing.T) {
 }
 
 func TestExpandInvalidArrayIndex(t *testing.T) {
-	// This test covers the error handling in getArrayIndex
+	// This test covers the error handling in parseIndex
 	input := map[string]interface{}{
 		"items.[abc]": "invalid",
 		"items.[]":    "empty",
@@ -267,7 +267,7 @@ func TestExpandArrayGapsWithMapType(t *testing.T) {
 }
 
 func TestExpandArrayIndexParseError(t *testing.T) {
-	// This test covers the strconv.Atoi error case in getArrayIndex
+	// This test covers the non-numeric case in parseIndex
 	input := map[string]interface{}{
 		"items.[1a2]": "invalid_number",
 		"items.[3b]":  "another_invalid",
@@ -340,4 +340,222 @@ func TestFlattenExpandRoundTrip(t *testing.T) {
 			assert.Equal(t, string(originalJSON), string(resultJSON))
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestExpandEMatchesExpand(t *testing.T) {
+	input := map[string]interface{}{
+		"users.[0].name":     "John",
+		"users.[2].tags.[1]": "admin",
+		"config.debug":       true,
+		"items.[0]":          "first",
+		"items.[3]":          "fourth",
+	}
+	result, err := ExpandE(input)
+	assert.NoError(t, err)
+	assert.Equal(t, Expand(input), result)
+}
+
+func TestExpandEConflicts(t *testing.T) {
+	input := map[string]interface{}{
+		"a":      1,
+		"a.b":    2,
+		"c.[0]":  3,
+		"c.x":    4,
+		"d.e":    5,
+		"d.e.f":  6,
+		"ok.key": "value",
+	}
+	result, err := ExpandE(input)
+	assert.Nil(t, result)
+
+	var conflicts ConflictErrors
+	assert.ErrorAs(t, err, &conflicts)
+	assert.Equal(t, ConflictErrors{
+		{Path: "a", Existing: "a", Incoming: "a.b"},
+		{Path: "c", Existing: "c.[0]", Incoming: "c.x"},
+		{Path: "d.e", Existing: "d.e", Incoming: "d.e.f"},
+	}, conflicts)
+
+	var conflict *ConflictError
+	assert.ErrorAs(t, err, &conflict)
+	assert.EqualError(t, conflict, `bellows: key "a.b" conflicts with key "a" at path "a"`)
+}
+
+func TestExpandEConflictPolicies(t *testing.T) {
+	input := map[string]interface{}{
+		"a":     1,
+		"a.b":   2,
+		"c.[0]": 3,
+		"c.x":   4,
+	}
+	tests := []struct {
+		name     string
+		policy   ConflictPolicy
+		expected map[string]interface{}
+	}{
+		{
+			name:   "first wins",
+			policy: ConflictFirstWins,
+			expected: map[string]interface{}{
+				"a": 1,
+				"c": []interface{}{3},
+			},
+		},
+		{
+			name:   "last wins",
+			policy: ConflictLastWins,
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{"b": 2},
+				"c": map[string]interface{}{"x": 4},
+			},
+		},
+		{
+			name:   "scalar wins",
+			policy: ConflictScalarWins,
+			expected: map[string]interface{}{
+				"a": 1,
+				"c": []interface{}{3},
+			},
+		},
+		{
+			name:   "container wins",
+			policy: ConflictContainerWins,
+			expected: map[string]interface{}{
+				"a": map[string]interface{}{"b": 2},
+				"c": []interface{}{3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ExpandE(input, WithConflictPolicy(tt.policy))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestExpandEContainerWinsOverLaterScalar(t *testing.T) {
+	input := map[string]interface{}{
+		"a.b": 1,
+		"a.c": 2,
+		"b":   3,
+		"a":   "scalar",
+	}
+	result, err := ExpandE(input, WithConflictPolicy(ConflictContainerWins))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{"b": 1, "c": 2},
+		"b": 3,
+	}, result)
+}
+
+func TestExpandDeterministic(t *testing.T) {
+	input := map[string]interface{}{
+		"a":          1,
+		"a.b":        2,
+		"c.[0]":      3,
+		"c.x":        4,
+		"list.[10]":  "k",
+		"list.[2]":   "c",
+		"list.[0].x": "a",
+	}
+	expected := map[string]interface{}{
+		"a": 1,
+		"c": []interface{}{3},
+		"list": []interface{}{
+			map[string]interface{}{"x": "a"}, nil, "c", nil, nil, nil, nil, nil, nil, nil, "k",
+		},
+	}
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, expected, Expand(input))
+	}
+}
+
+func TestSortPaths(t *testing.T) {
+	keys := []string{"a.[10]", "a.[2]", "b", "a.[02]", "a", "a.[1].x", "a.[1]", "item10", "item9"}
+	sortPaths(keys)
+	assert.Equal(t, []string{"a", "a.[1]", "a.[1].x", "a.[02]", "a.[2]", "a.[10]", "b", "item9", "item10"}, keys)
+}
+
+func TestExpandMaxDepth(t *testing.T) {
+	input := map[string]interface{}{
+		"a.b":       1,
+		"a.c.d":     2,
+		"x.[0].y.z": 3,
+	}
+	expected := map[string]interface{}{
+		"a": map[string]interface{}{"b": 1},
+	}
+	assert.Equal(t, expected, Expand(input, WithMaxDepth(2)))
+
+	result, err := ExpandE(input, WithMaxDepth(2))
+	assert.Nil(t, result)
+	assert.EqualError(t, err, "bellows: path \"a.c.d\" exceeds max depth 2\n"+
+		"bellows: path \"x.[0].y.z\" exceeds max depth 2")
+
+	var depthErr *DepthError
+	assert.ErrorAs(t, err, &depthErr)
+	assert.Equal(t, "a.c.d", depthErr.Path)
+}
+
+func TestExpandSparsePolicies(t *testing.T) {
+	input := map[string]interface{}{
+		"list.[0]":      "a",
+		"list.[3]":      "b",
+		"dense.[0]":     1,
+		"dense.[1]":     2,
+		"rows.[2].name": "c",
+	}
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected map[string]interface{}
+	}{
+		{
+			name: "fill",
+			expected: map[string]interface{}{
+				"list":  []interface{}{"a", nil, nil, "b"},
+				"dense": []interface{}{1, 2},
+				"rows": []interface{}{
+					map[string]interface{}{},
+					map[string]interface{}{},
+					map[string]interface{}{"name": "c"},
+				},
+			},
+		},
+		{
+			name: "fill with nil gaps",
+			opts: []Option{WithNilGaps()},
+			expected: map[string]interface{}{
+				"list":  []interface{}{"a", nil, nil, "b"},
+				"dense": []interface{}{1, 2},
+				"rows":  []interface{}{nil, nil, map[string]interface{}{"name": "c"}},
+			},
+		},
+		{
+			name: "index map",
+			opts: []Option{WithSparsePolicy(SparseIndexMap)},
+			expected: map[string]interface{}{
+				"list":  map[int]interface{}{0: "a", 3: "b"},
+				"dense": []interface{}{1, 2},
+				"rows":  map[int]interface{}{2: map[string]interface{}{"name": "c"}},
+			},
+		},
+		{
+			name: "compact",
+			opts: []Option{WithSparsePolicy(SparseCompact)},
+			expected: map[string]interface{}{
+				"list":  []interface{}{"a", "b"},
+				"dense": []interface{}{1, 2},
+				"rows":  []interface{}{map[string]interface{}{"name": "c"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Expand(input, tt.opts...))
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package bellows
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fieldInfo describes how a struct field is keyed when flattening and
+// expanding, so both directions agree on the same names.
+type fieldInfo struct {
+	index     int
+	name      string
+	inline    bool
+	omitEmpty bool
+}
+
+// structFields returns the exported fields of t. When tagName is set, the
+// named struct tag supplies the key, "-" skips the field, "omitempty" drops
+// zero values and "inline" or "squash" promotes the field like an embedded one.
+// ExpandInto fills an inlined map with the keys no other field uses.
+func structFields(t reflect.Type, tagName string) []fieldInfo {
+	fields := make([]fieldInfo, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		// Skip unexported fields (PkgPath is empty for exported fields)
+		if f.PkgPath != "" {
+			continue
+		}
+		info := fieldInfo{index: i, name: f.Name, inline: f.Anonymous}
+		if tagName != "" {
+			tag, ok := f.Tag.Lookup(tagName)
+			if tag == "-" {
+				continue
+			}
+			name, flags, _ := strings.Cut(tag, ",")
+			if name != "" {
+				info.name = name
+				info.inline = false
+			}
+			for ok && flags != "" {
+				var flag string
+				flag, flags, _ = strings.Cut(flags, ",")
+				switch flag {
+				case "omitempty":
+					info.omitEmpty = true
+				case "inline", "squash":
+					info.inline = true
+				}
+			}
+		}
+		fields = append(fields, info)
+	}
+	return fields
+}
+
+type fieldCacheKey struct {
+	t       reflect.Type
+	tagName string
+}
+
+// fieldCache holds the structFields of every struct type flattened so far.
+var fieldCache sync.Map // fieldCacheKey -> []fieldInfo
+
+// cachedStructFields is like structFields, but only inspects each type and
+// tag name once. The returned slice is shared and must not be modified.
+func cachedStructFields(t reflect.Type, tagName string) []fieldInfo {
+	key := fieldCacheKey{t: t, tagName: tagName}
+	if fields, ok := fieldCache.Load(key); ok {
+		return fields.([]fieldInfo)
+	}
+	fields, _ := fieldCache.LoadOrStore(key, structFields(t, tagName))
+	return fields.([]fieldInfo)
+}
+
+// isEmptyValue reports whether v is empty in the sense of encoding/json's
+// omitempty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,84 @@
+package bellows
+
+// filter holds the compiled WithInclude and WithExclude patterns.
+type filter struct {
+	include [][]segment
+	exclude [][]segment
+}
+
+type matchMode uint8
+
+const (
+	// matchExact matches the whole path.
+	matchExact matchMode = iota
+	// matchAncestor also matches when the pattern matches an ancestor of
+	// the path.
+	matchAncestor
+	// matchDescendant also matches when the pattern could match a
+	// descendant of the path.
+	matchDescendant
+)
+
+func (o *Options) compileFilter() *filter {
+	if len(o.Include) == 0 && len(o.Exclude) == 0 {
+		return nil
+	}
+	f := &filter{}
+	for _, pattern := range o.Include {
+		f.include = append(f.include, o.parsePattern(pattern))
+	}
+	for _, pattern := range o.Exclude {
+		f.exclude = append(f.exclude, o.parsePattern(pattern))
+	}
+	return f
+}
+
+// keep reports whether a flat key with the given path passes the filter.
+func (f *filter) keep(path []segment) bool {
+	if anyMatch(f.exclude, path, matchAncestor) {
+		return false
+	}
+	return len(f.include) == 0 || anyMatch(f.include, path, matchAncestor)
+}
+
+func anyMatch(patterns [][]segment, path []segment, mode matchMode) bool {
+	for _, pattern := range patterns {
+		if matchPath(pattern, path, mode) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(pattern, path []segment, mode matchMode) bool {
+	for len(pattern) > 0 {
+		if pattern[0].kind == anyPathSegment {
+			for i := 0; i <= len(path); i++ {
+				if matchPath(pattern[1:], path[i:], mode) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return mode == matchDescendant
+		}
+		if !matchSegment(pattern[0], path[0]) {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0 || mode == matchAncestor
+}
+
+func matchSegment(p, s segment) bool {
+	switch p.kind {
+	case anySegment:
+		return true
+	case anyIndexSegment:
+		return s.kind == indexSegment || s.kind == appendSegment
+	case indexSegment:
+		return s.kind == indexSegment && s.index == p.index
+	}
+	return s.kind == keySegment && s.name == p.name
+}
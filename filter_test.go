@@ -0,0 +1,122 @@
+package bellows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var filterInput = map[string]interface{}{
+	"database": map[string]interface{}{
+		"host": "db",
+		"pool": map[string]interface{}{"size": 10},
+	},
+	"services": []interface{}{
+		map[string]interface{}{"name": "api", "port": 80},
+		map[string]interface{}{"name": "web", "port": 443},
+	},
+	"secret": "hunter2",
+}
+
+func TestFlattenInclude(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "single segment wildcard",
+			patterns: []string{"database.*"},
+			expected: map[string]interface{}{
+				"database.host":      "db",
+				"database.pool.size": 10,
+			},
+		},
+		{
+			name:     "index wildcard",
+			patterns: []string{"services.[*].name"},
+			expected: map[string]interface{}{
+				"services.[0].name": "api",
+				"services.[1].name": "web",
+			},
+		},
+		{
+			name:     "any depth",
+			patterns: []string{"**.size", "secret"},
+			expected: map[string]interface{}{
+				"database.pool.size": 10,
+				"secret":             "hunter2",
+			},
+		},
+		{
+			name:     "subtree",
+			patterns: []string{"services.[1]"},
+			expected: map[string]interface{}{
+				"services.[1].name": "web",
+				"services.[1].port": 443,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Flatten(filterInput, WithInclude(tt.patterns...)))
+		})
+	}
+}
+
+func TestFlattenExclude(t *testing.T) {
+	result := Flatten(filterInput, WithExclude("secret", "services.[*].port", "database.pool"))
+	assert.Equal(t, map[string]interface{}{
+		"database.host":     "db",
+		"services.[0].name": "api",
+		"services.[1].name": "web",
+	}, result)
+
+	result = Flatten(filterInput, WithInclude("services"), WithExclude("**.port"))
+	assert.Equal(t, map[string]interface{}{
+		"services.[0].name": "api",
+		"services.[1].name": "web",
+	}, result)
+}
+
+func TestFlattenFilterPrunesSubtrees(t *testing.T) {
+	type Node struct {
+		Name  string
+		Child *Node
+	}
+	node := &Node{Name: "root"}
+	node.Child = node
+
+	// The cyclic Child field is never walked, so no cycle is reported
+	result, err := FlattenE(node, WithInclude("Name"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Name": "root"}, result)
+
+	result, err = FlattenE(node, WithExclude("Child"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Name": "root"}, result)
+}
+
+func TestFlattenFilterWithPrefixAndStyle(t *testing.T) {
+	result := Flatten(filterInput, WithPrefix("app"), WithIndexStyle(IndexBracket), WithInclude("app.services[*].name"))
+	assert.Equal(t, map[string]interface{}{
+		"app.services[0].name": "api",
+		"app.services[1].name": "web",
+	}, result)
+
+	result = Flatten(filterInput, WithPrefix("app"), WithInclude("app"), WithExclude("app.services", "app.database"))
+	assert.Equal(t, map[string]interface{}{"app.secret": "hunter2"}, result)
+}
+
+func TestExpandFilter(t *testing.T) {
+	flat := Flatten(filterInput)
+	result := Expand(flat, WithInclude("database.*", "services.[*].name"), WithExclude("database.pool"))
+	assert.Equal(t, map[string]interface{}{
+		"database": map[string]interface{}{"host": "db"},
+		"services": []interface{}{
+			map[string]interface{}{"name": "api"},
+			map[string]interface{}{"name": "web"},
+		},
+	}, result)
+}
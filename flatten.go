@@ -3,90 +3,442 @@ package bellows
 import (
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 )
 
-func Flatten(value interface{}, opts ...option) map[string]interface{} {
-	options := &bellowsOptions{
-		prefix: "",
-		sep:    ".",
-	}
-	for _, opt := range opts {
-		opt(options)
+// Flatten turns a nested value into a flat map. It stops at the first error,
+// such as a cycle, and returns what was flattened so far; use FlattenE to see
+// the error.
+func Flatten(value interface{}, opts ...Option) map[string]interface{} {
+	m, _ := flatten(value, newOptions(opts))
+	return m
+}
+
+// FlattenE is like Flatten, but returns the error that stopped it, such as a
+// *CycleError.
+func FlattenE(value interface{}, opts ...Option) (map[string]interface{}, error) {
+	m, err := flattenChecked(value, newOptions(opts))
+	if err != nil {
+		return nil, err
 	}
+	return m, nil
+}
+
+func flatten(value interface{}, opts *Options) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, 5)
+	return m, flattenInto(value, opts.Prefix, m, opts)
+}
+
+// flattenChecked is like flatten, but walks MapFlattener types with
+// reflection too, since FlattenTo cannot report errors.
+func flattenChecked(value interface{}, opts *Options) (map[string]interface{}, error) {
 	m := make(map[string]interface{}, 5)
-	FlattenPrefixedToResult(value, options, m)
+	return m, flattenCheckedInto(value, opts.Prefix, m, opts)
+}
+
+// flattenCheckedInto is like flattenInto for flattenChecked.
+func flattenCheckedInto(value interface{}, prefix string, m map[string]interface{}, opts *Options) error {
+	var w walker
+	w.init(opts, prefix)
+	w.m, w.reflectOnly = m, true
+	return w.run(value)
+}
+
+// flattenInto stores the keys of value below prefix in m.
+func flattenInto(value interface{}, prefix string, m map[string]interface{}, opts *Options) error {
+	var w walker
+	w.init(opts, prefix)
+	w.m = m
+	return w.run(value)
+}
+
+// FlattenPrefixed is like Flatten, with every key below prefix.
+func FlattenPrefixed(value interface{}, prefix string, opts ...Option) map[string]interface{} {
+	m := make(map[string]interface{}, 5)
+	FlattenPrefixedToResult(value, prefix, m, opts...)
 	return m
 }
 
-func FlattenPrefixedToResult(value interface{}, opts *bellowsOptions, m map[string]interface{}) {
-	original := reflect.ValueOf(value)
+// FlattenPrefixedToResult flattens value below prefix into the existing map
+// m, overwriting keys it already has, so several sources can be merged into
+// one flat map. prefix takes the place of any WithPrefix option. Like
+// Flatten, it stops at the first error; use FlattenPrefixedToResultE to see
+// the error.
+func FlattenPrefixedToResult(value interface{}, prefix string, m map[string]interface{}, opts ...Option) {
+	_ = flattenInto(value, prefix, m, newOptions(opts))
+}
+
+// FlattenPrefixedToResultE is like FlattenPrefixedToResult, but returns the
+// error that stopped it, such as a *CycleError. The keys stored before the
+// error stay in m.
+func FlattenPrefixedToResultE(value interface{}, prefix string, m map[string]interface{}, opts ...Option) error {
+	return flattenCheckedInto(value, prefix, m, newOptions(opts))
+}
+
+// walker holds the state of a single flatten traversal.
+type walker struct {
+	opts *Options
+	fn   func(key string, v interface{}) error
+	// prefix is the key the walk starts at.
+	prefix string
+	// m is where leaves are stored when there is no fn.
+	m map[string]interface{}
+	// reflectOnly walks MapFlattener types with reflection as well.
+	reflectOnly bool
+	// buf holds the key of the value being walked. Children append their
+	// segment to it and truncate it again once done, so keys are only
+	// allocated for the leaves stored. scratch backs buf for short keys.
+	buf     []byte
+	scratch [64]byte
+	// root is a prefix of buf that is already a string, the configured
+	// prefix or a top-level key, so leaves stored right there need no copy.
+	root string
+	// ancestors maps the identity of every pointer, map and slice on the
+	// current path to the length of its key in buf.
+	ancestors map[identity]int
+	// path holds the segments of the current prefix when filtering, and
+	// included whether everything below it passes WithInclude.
+	path     []segment
+	included bool
+	// sortKeys visits map keys in natural order instead of map order.
+	sortKeys bool
+}
+
+type mapKey struct {
+	name  string
+	value reflect.Value
+}
+
+type identity struct {
+	t   reflect.Type
+	ptr uintptr
+}
+
+func newWalker(opts *Options, prefix string, fn func(key string, v interface{}) error) *walker {
+	w := &walker{fn: fn}
+	w.init(opts, prefix)
+	return w
+}
+
+// init prepares w to walk from prefix.
+func (w *walker) init(opts *Options, prefix string) {
+	w.opts, w.prefix, w.included = opts, prefix, true
+	w.buf = w.scratch[:0]
+	if f := opts.filter; f != nil && prefix != "" {
+		w.path = opts.parsePath(prefix)
+		w.included = len(f.include) == 0 || anyMatch(f.include, w.path, matchAncestor)
+	} else if f != nil {
+		w.included = len(f.include) == 0
+	}
+}
+
+// run walks value from the configured prefix.
+func (w *walker) run(value interface{}) error {
+	w.buf = append(w.buf[:0], w.prefix...)
+	w.root = w.prefix
+	return w.walk(reflect.ValueOf(value), w.prefixDepth())
+}
+
+// prefixDepth returns the number of segments in the prefix, which count
+// towards MaxDepth as they do when the keys are expanded.
+func (w *walker) prefixDepth() int {
+	switch {
+	case w.opts.MaxDepth == 0 || w.prefix == "":
+		return 0
+	case w.path != nil:
+		return len(w.path)
+	}
+	return len(w.opts.parsePath(w.prefix))
+}
+
+// pushKey appends a map key or field name to the current key and returns the
+// length to truncate it back to.
+func (w *walker) pushKey(name string) int {
+	return w.push(w.opts.escapeKey(name))
+}
+
+// push is like pushKey for a key that is escaped already.
+func (w *walker) push(name string) int {
+	n := len(w.buf)
+	if n > 0 {
+		w.buf = append(w.buf, w.opts.Sep...)
+	} else {
+		w.root = name
+	}
+	w.buf = append(w.buf, name...)
+	return n
+}
+
+// pushIndex is like pushKey for item i of a slice or array, see indexKey.
+func (w *walker) pushIndex(i int) int {
+	n := len(w.buf)
+	if n == 0 {
+		w.root = ""
+	}
+	switch w.opts.IndexStyle {
+	case IndexBracket:
+		w.buf = append(w.buf, '[')
+		w.buf = strconv.AppendInt(w.buf, int64(i), 10)
+		w.buf = append(w.buf, ']')
+	case IndexDot:
+		if n > 0 {
+			w.buf = append(w.buf, w.opts.Sep...)
+		}
+		w.buf = strconv.AppendInt(w.buf, int64(i), 10)
+	default:
+		w.buf = append(w.buf, w.opts.Sep...)
+		w.buf = append(w.buf, '[')
+		w.buf = strconv.AppendInt(w.buf, int64(i), 10)
+		w.buf = append(w.buf, ']')
+	}
+	return n
+}
+
+// child walks v, found one segment below the current path at the key pushed
+// last, unless the filter prunes it. It truncates the key back to n after.
+func (w *walker) child(v reflect.Value, depth int, seg segment, n int) error {
+	defer func() { w.buf = w.buf[:n] }()
+	f := w.opts.filter
+	if f == nil {
+		return w.walk(v, depth)
+	}
+	w.path = append(w.path, seg)
+	included := w.included
+	defer func() {
+		w.path = w.path[:len(w.path)-1]
+		w.included = included
+	}()
+
+	// Ancestors have been checked already, so exact matches suffice
+	if anyMatch(f.exclude, w.path, matchExact) {
+		return nil
+	}
+	if !w.included {
+		if anyMatch(f.include, w.path, matchExact) {
+			w.included = true
+		} else if !anyMatch(f.include, w.path, matchDescendant) {
+			return nil
+		}
+	}
+	return w.walk(v, depth)
+}
+
+// emit passes a leaf value at the current key on to the walk's callback.
+func (w *walker) emit(value interface{}) error {
+	if !w.included {
+		return nil
+	}
+	return w.store(value)
+}
+
+// store is like emit, regardless of the filter.
+func (w *walker) store(value interface{}) error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	if w.fn == nil {
+		w.m[w.key()] = value
+		return nil
+	}
+	return w.fn(w.key(), value)
+}
+
+// key returns the current key as a string.
+func (w *walker) key() string {
+	if len(w.buf) == len(w.root) {
+		return w.root
+	}
+	return string(w.buf)
+}
+
+func (w *walker) walk(original reflect.Value, depth int) error {
+	opts := w.opts
+	// Values held in interfaces are walked as their concrete value
+	for original.Kind() == reflect.Interface {
+		original = original.Elem()
+	}
 	kind := original.Kind()
-	if kind == reflect.Ptr || kind == reflect.Interface {
-		original = reflect.Indirect(original)
+
+	if opts.EncodeHook != nil && len(w.buf) > 0 {
+		prefix := string(w.buf)
+		v, handled, err := opts.EncodeHook(prefix, original)
+		if err != nil {
+			return fmt.Errorf("bellows: encode hook failed at %q: %w", prefix, err)
+		}
+		if handled {
+			return w.emit(v)
+		}
+	}
+
+	if original.IsValid() {
+		if f, ok := flattenable(original); ok {
+			return w.flattenCustom(f)
+		}
+	}
+
+	switch kind {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if original.IsNil() || (kind == reflect.Slice && original.Len() == 0) {
+			break
+		}
+		id := identity{t: original.Type(), ptr: original.Pointer()}
+		if n, ok := w.ancestors[id]; ok {
+			return w.cycle(string(w.buf[:n]))
+		}
+		if w.ancestors == nil {
+			w.ancestors = make(map[identity]int)
+		}
+		w.ancestors[id] = len(w.buf)
+		defer delete(w.ancestors, id)
+	}
+
+	value := original
+	isPtr := kind == reflect.Ptr
+	if isPtr {
+		original = original.Elem()
 		kind = original.Kind()
+		for opts.DerefPointers && kind == reflect.Ptr {
+			original = original.Elem()
+			kind = original.Kind()
+		}
 	}
 
 	if !original.IsValid() {
-		if opts.prefix != "" {
-			m[opts.prefix] = nil
+		if isPtr && opts.OmitNilPointers {
+			return nil
 		}
-		return
+		return w.emit(nil)
 	}
 
 	t := original.Type()
+	composite := kind == reflect.Map || kind == reflect.Struct || kind == reflect.Array || kind == reflect.Slice
+
+	// Scalars are stored whole anyway, only composites and dereferenced
+	// pointers depend on whether t is a leaf type
+	var plan typePlan
+	if composite || isPtr && opts.DerefPointers {
+		plan = opts.plan(t)
+	}
+	if plan.leaf {
+		// Keep the pointer when only it has the methods that made t a leaf
+		if opts.DerefPointers && plan.leafValue {
+			return w.emit(original.Interface())
+		}
+		return w.emit(value.Interface())
+	}
+
+	if composite && opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+		if opts.DepthPolicy == DepthFail {
+			return &DepthError{Path: string(w.buf), MaxDepth: opts.MaxDepth}
+		}
+		return w.emit(value.Interface())
+	}
+
+	// Empty maps and slices leave no keys behind, so record them explicitly
+	if opts.EmptyContainers && len(w.buf) > 0 {
+		switch {
+		case (kind == reflect.Map || kind == reflect.Slice) && original.IsNil():
+			return w.emit(nil)
+		case kind == reflect.Map && original.Len() == 0:
+			return w.emit(map[string]interface{}{})
+		case (kind == reflect.Slice || kind == reflect.Array) && original.Len() == 0:
+			return w.emit([]interface{}{})
+		}
+	}
 
 	switch kind {
 	case reflect.Map:
-		if t.Key().Kind() != reflect.String {
+		if opts.StringKeysOnly && t.Key().Kind() != reflect.String {
 			break
 		}
-		keys := original.MapKeys()
-		base := ""
-		if opts.prefix != "" {
-			base = opts.prefix + opts.sep
+		if w.sortKeys {
+			return w.walkSortedMap(original, depth)
 		}
-		for _, childKey := range keys {
-			childValue := original.MapIndex(childKey)
-			FlattenPrefixedToResult(childValue.Interface(), &bellowsOptions{
-				prefix: base + childKey.String(),
-				sep:    opts.sep,
-			}, m)
+		iter := original.MapRange()
+		for iter.Next() {
+			name, ok := formatMapKey(iter.Key())
+			if !ok {
+				continue
+			}
+			seg := segment{kind: keySegment, name: name}
+			if err := w.child(iter.Value(), depth+1, seg, w.pushKey(name)); err != nil {
+				return err
+			}
 		}
 	case reflect.Struct:
-		numField := original.NumField()
-		base := ""
-		for i := 0; i < numField; i++ {
-			f := t.Field(i)
-			// Skip unexported fields (PkgPath is empty for exported fields)
-			if f.PkgPath != "" {
+		if plan.generated && w.m != nil && !w.reflectOnly {
+			// A pointer has the method too and saves copying the struct
+			if original.CanAddr() {
+				original = original.Addr()
+			}
+			original.Interface().(MapFlattener).FlattenTo(w.m, w.key())
+			return nil
+		}
+		for i, f := range plan.fields {
+			childValue := original.Field(f.index)
+			if f.omitEmpty && isEmptyValue(childValue) {
 				continue
 			}
-			childValue := original.Field(i)
-			childKey := f.Name
-			if f.Anonymous {
-				childKey = ""
-				base = opts.prefix
-			} else if opts.prefix != "" {
-				base = opts.prefix + opts.sep
+			var err error
+			if f.inline {
+				err = w.walk(childValue, depth)
+			} else {
+				seg := segment{kind: keySegment, name: f.name}
+				err = w.child(childValue, depth+1, seg, w.push(plan.fieldKey(opts, i)))
+			}
+			if err != nil {
+				return err
 			}
-			FlattenPrefixedToResult(childValue.Interface(), &bellowsOptions{
-				prefix: base + childKey,
-				sep:    opts.sep,
-			}, m)
 		}
 	case reflect.Array, reflect.Slice:
 		l := original.Len()
-		base := opts.prefix
 		for i := 0; i < l; i++ {
-			childValue := original.Index(i)
-			FlattenPrefixedToResult(childValue.Interface(), &bellowsOptions{
-				prefix: fmt.Sprintf("%s%s[%d]", base, opts.sep, i),
-				sep:    opts.sep,
-			}, m)
+			seg := segment{kind: indexSegment, index: i}
+			if err := w.child(original.Index(i), depth+1, seg, w.pushIndex(i)); err != nil {
+				return err
+			}
 		}
 	default:
-		if opts.prefix != "" {
-			m[opts.prefix] = value
+		if opts.DerefPointers {
+			return w.emit(original.Interface())
 		}
+		return w.emit(value.Interface())
+	}
+	return nil
+}
+
+// walkSortedMap walks the entries of the map m in natural key order.
+func (w *walker) walkSortedMap(m reflect.Value, depth int) error {
+	keys := make([]mapKey, 0, m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		if name, ok := formatMapKey(iter.Key()); ok {
+			keys = append(keys, mapKey{name: name, value: iter.Value()})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return naturalLess(keys[i].name, keys[j].name)
+	})
+	for _, key := range keys {
+		seg := segment{kind: keySegment, name: key.name}
+		if err := w.child(key.value, depth+1, seg, w.pushKey(key.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cycle handles a value at the current key that refers back to its ancestor
+// at target.
+func (w *walker) cycle(target string) error {
+	switch w.opts.CyclePolicy {
+	case CycleRef:
+		n := w.pushKey("$ref")
+		defer func() { w.buf = w.buf[:n] }()
+		return w.emit(target)
+	case CycleFail:
+		return &CycleError{Path: string(w.buf), Target: target}
 	}
+	return nil
 }
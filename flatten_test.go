@@ -169,13 +169,13 @@ func TestFlattenWithBothPrefixAndSeparator(t *testing.T) {
 }
 
 func TestFlattenMapWithNonStringKeys(t *testing.T) {
-	// Maps with non-string keys should not be flattened
+	// Maps with non-string keys should not be flattened with WithStringKeysOnly
 	input := map[int]string{
 		1: "one",
 		2: "two",
 	}
 	expected := map[string]interface{}{}
-	result := Flatten(input)
+	result := Flatten(input, WithStringKeysOnly())
 	assert.Equal(t, expected, result)
 }
 
@@ -192,4 +192,237 @@ func TestFlattenInterface(t *testing.T) {
 	}
 	result := Flatten(input)
 	assert.Equal(t, expected, result)
-}
\ No newline at end of file
+}
+
+type cycleNode struct {
+	Name     string
+	Parent   *cycleNode
+	Children []*cycleNode
+}
+
+func newCycle() *cycleNode {
+	root := &cycleNode{Name: "root"}
+	child := &cycleNode{Name: "child", Parent: root}
+	root.Children = []*cycleNode{child}
+	return root
+}
+
+func TestFlattenECycleFail(t *testing.T) {
+	result, err := FlattenE(newCycle())
+	assert.Nil(t, result)
+
+	var cycleErr *CycleError
+	assert.ErrorAs(t, err, &cycleErr)
+	assert.Equal(t, &CycleError{Path: "Children.[0].Parent", Target: ""}, cycleErr)
+}
+
+func TestFlattenCycleRef(t *testing.T) {
+	result, err := FlattenE(newCycle(), WithCyclePolicy(CycleRef))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"Name":                     "root",
+		"Parent":                   nil,
+		"Children.[0].Name":        "child",
+		"Children.[0].Parent.$ref": "",
+	}, result)
+}
+
+func TestFlattenCycleSkip(t *testing.T) {
+	result, err := FlattenE(newCycle(), WithCyclePolicy(CycleSkip), WithPrefix("tree"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"tree.Name":              "root",
+		"tree.Parent":            nil,
+		"tree.Children.[0].Name": "child",
+	}, result)
+}
+
+func TestFlattenCyclicMap(t *testing.T) {
+	m := map[string]interface{}{"name": "loop"}
+	m["self"] = m
+	result, err := FlattenE(m, WithCyclePolicy(CycleRef))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":      "loop",
+		"self.$ref": "",
+	}, result)
+}
+
+func TestFlattenSharedValuesAreNotCycles(t *testing.T) {
+	shared := &B{C: "shared", D: 1}
+	input := map[string]interface{}{"x": shared, "y": shared}
+	result, err := FlattenE(input)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"x.C": "shared",
+		"x.D": 1,
+		"y.C": "shared",
+		"y.D": 1,
+	}, result)
+}
+
+func TestFlattenMaxDepth(t *testing.T) {
+	inner := map[string]interface{}{"d": []int{1, 2}}
+	input := map[string]interface{}{
+		"a": 1,
+		"b": map[string]interface{}{
+			"c": inner,
+			"e": "leaf",
+		},
+	}
+
+	result, err := FlattenE(input, WithMaxDepth(2), WithDepthPolicy(DepthLeaf))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a":   1,
+		"b.c": inner,
+		"b.e": "leaf",
+	}, result)
+
+	result, err = FlattenE(input, WithMaxDepth(2))
+	assert.Nil(t, result)
+	assert.Equal(t, &DepthError{Path: "b.c", MaxDepth: 2}, err)
+
+	result, err = FlattenE(input, WithMaxDepth(4))
+	assert.NoError(t, err)
+	assert.Equal(t, Flatten(input), result)
+}
+
+func TestFlattenMaxDepthCountsPrefix(t *testing.T) {
+	input := map[string]interface{}{"a": map[string]interface{}{"b": 1}}
+
+	// Expand limits whole keys, so the prefix counts when flattening too
+	_, err := FlattenE(input, WithPrefix("p"), WithMaxDepth(2))
+	assert.Equal(t, &DepthError{Path: "p.a", MaxDepth: 2}, err)
+
+	result, err := FlattenE(input, WithPrefix("p.[0]"), WithMaxDepth(3), WithDepthPolicy(DepthLeaf))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"p.[0].a": map[string]interface{}{"b": 1}}, result)
+	_, err = ExpandE(result, WithMaxDepth(3))
+	assert.NoError(t, err)
+
+	result, err = FlattenE(input, WithPrefix("p"), WithMaxDepth(3))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"p.a.b": 1}, result)
+	_, err = ExpandE(result, WithMaxDepth(3))
+	assert.NoError(t, err)
+}
+
+func TestFlattenMaxDepthIgnoresEmbeddedStructs(t *testing.T) {
+	a := A{F: 1, B: B{C: "test", D: 2}}
+	result, err := FlattenE(a, WithMaxDepth(1), WithDepthPolicy(DepthLeaf))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"F":     1,
+		"C":     "test",
+		"D":     2,
+		"Inner": Inner{},
+	}, result)
+}
+
+func TestFlattenEmptyContainers(t *testing.T) {
+	type Patch struct {
+		Tags   []string
+		Labels map[string]string
+		Owners []string
+		Extra  map[string]interface{}
+	}
+	input := Patch{
+		Tags:   []string{},
+		Labels: map[string]string{},
+	}
+	expected := map[string]interface{}{
+		"Tags":   []interface{}{},
+		"Labels": map[string]interface{}{},
+		"Owners": nil,
+		"Extra":  nil,
+	}
+	flat := Flatten(input, WithEmptyContainers())
+	assert.Equal(t, expected, flat)
+
+	var result Patch
+	assert.NoError(t, ExpandInto(flat, &result))
+	assert.Equal(t, input, result)
+	assert.NotNil(t, result.Tags)
+	assert.Nil(t, result.Owners)
+}
+
+func TestEmptyContainersRoundTrip(t *testing.T) {
+	input := map[string]interface{}{
+		"empty": []interface{}{},
+		"nested": map[string]interface{}{
+			"none": map[string]interface{}{},
+			"list": []interface{}{[]interface{}{}, "x"},
+		},
+	}
+	flat := Flatten(input, WithEmptyContainers())
+	assert.Equal(t, map[string]interface{}{
+		"empty":           []interface{}{},
+		"nested.none":     map[string]interface{}{},
+		"nested.list.[0]": []interface{}{},
+		"nested.list.[1]": "x",
+	}, flat)
+	assert.Equal(t, input, Expand(flat))
+}
+
+func TestExpandMergesEmptyContainers(t *testing.T) {
+	input := map[string]interface{}{
+		"a":     map[string]interface{}{},
+		"a.b":   1,
+		"c":     []interface{}{},
+		"c.[0]": 2,
+	}
+	result, err := ExpandE(input)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{"b": 1},
+		"c": []interface{}{2},
+	}, result)
+}
+
+func TestFlattenPrefixed(t *testing.T) {
+	input := map[string]interface{}{"a": []int{1}}
+	assert.Equal(t, map[string]interface{}{"p.a.[0]": 1}, FlattenPrefixed(input, "p"))
+	assert.Equal(t, map[string]interface{}{"p/a/[0]": 1}, FlattenPrefixed(input, "p", WithSep("/")))
+}
+
+func TestFlattenPrefixedToResultMerges(t *testing.T) {
+	m := map[string]interface{}{"db.host": "old", "kept": true}
+	FlattenPrefixedToResult(map[string]interface{}{"host": "localhost", "port": 5432}, "db", m)
+	// The prefix argument replaces WithPrefix
+	FlattenPrefixedToResult(map[string]interface{}{"level": "debug"}, "log", m, WithPrefix("ignored"))
+	assert.Equal(t, map[string]interface{}{
+		"db.host":   "localhost",
+		"db.port":   5432,
+		"log.level": "debug",
+		"kept":      true,
+	}, m)
+}
+
+func TestFlattenPrefixedToResultE(t *testing.T) {
+	cyclic := map[string]interface{}{"name": "a"}
+	cyclic["self"] = cyclic
+
+	m := map[string]interface{}{"kept": true}
+	FlattenPrefixedToResult(cyclic, "x", m)
+	err := FlattenPrefixedToResultE(cyclic, "x", m)
+	var cycleErr *CycleError
+	assert.ErrorAs(t, err, &cycleErr)
+	assert.Equal(t, true, m["kept"])
+
+	err = NewFlattener(WithMaxDepth(1), WithDepthPolicy(DepthFail)).FlattenPrefixedToResultE(
+		map[string]interface{}{"a": map[string]interface{}{"b": 1}}, "x", m)
+	assert.Error(t, err)
+
+	assert.NoError(t, FlattenPrefixedToResultE(map[string]interface{}{"level": "debug"}, "log", m))
+	assert.Equal(t, "debug", m["log.level"])
+}
+
+func TestCustomOption(t *testing.T) {
+	envStyle := func(o *Options) {
+		o.Sep = "__"
+		o.IndexStyle = IndexDot
+	}
+	result := Flatten(map[string]interface{}{"db": map[string]interface{}{"hosts": []string{"a"}}}, envStyle)
+	assert.Equal(t, map[string]interface{}{"db__hosts__0": "a"}, result)
+}
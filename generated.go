@@ -0,0 +1,138 @@
+package bellows
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// MapFlattener is implemented by types that flatten themselves, such as those
+// generated by cmd/bellowsgen. FlattenTo stores the keys of the value below
+// prefix in m, exactly as Flatten would with default options. It has no way to
+// report errors, so it must only be implemented by types whose values cannot
+// be cyclic; FlattenE and Walk always use reflection.
+type MapFlattener interface {
+	FlattenTo(m map[string]interface{}, prefix string)
+}
+
+// MapExpander is implemented by pointers to types that expand themselves from
+// a flat map, such as those generated by cmd/bellowsgen, doing what
+// ExpandInto would with default options.
+type MapExpander interface {
+	ExpandFrom(flat map[string]interface{}) error
+}
+
+// tagNamer reports the struct tag a MapFlattener or MapExpander keys its
+// fields by. Types without it key fields by their Go names.
+type tagNamer interface {
+	BellowsTagName() string
+}
+
+var mapFlattenerType = reflect.TypeOf((*MapFlattener)(nil)).Elem()
+
+// generatedTags holds the tag name of every MapFlattener type seen so far.
+var generatedTags sync.Map // reflect.Type -> string
+
+// usesMapFlattener reports whether values of the struct type t should be
+// flattened by their FlattenTo method.
+func (o *Options) usesMapFlattener(t reflect.Type) bool {
+	if !o.plain || !t.Implements(mapFlattenerType) {
+		return false
+	}
+	tag, ok := generatedTags.Load(t)
+	if !ok {
+		tag = ""
+		if tn, ok := reflect.Zero(t).Interface().(tagNamer); ok {
+			tag = tn.BellowsTagName()
+		}
+		generatedTags.Store(t, tag)
+	}
+	return tag.(string) == o.TagName
+}
+
+// mapExpanderFor returns dst as a MapExpander when it should expand itself.
+func (o *Options) mapExpanderFor(dst interface{}) (MapExpander, bool) {
+	me, ok := dst.(MapExpander)
+	if !ok || !o.plain {
+		return nil, false
+	}
+	tag := ""
+	if tn, ok := dst.(tagNamer); ok {
+		tag = tn.BellowsTagName()
+	}
+	return me, tag == o.TagName
+}
+
+// isPlain reports whether o only differs from the defaults in ways generated
+// methods honor, so they produce the same keys and values as reflection.
+// CyclePolicy does not matter, as MapFlattener types cannot be cyclic.
+func (o *Options) isPlain() bool {
+	return o.Sep == "." && o.IndexStyle == IndexDotBracket && !o.Escaping &&
+		o.ConflictPolicy == ConflictFail &&
+		o.MaxDepth == 0 && !o.StrictIndex && o.MaxIndex == 0 && o.MaxSparsity == 0 &&
+		o.SparsePolicy == SparseFill && !o.NilGaps &&
+		!o.EmptyContainers && !o.StringKeysOnly &&
+		o.LeafInterfaces == LeafTextMarshaler && len(o.LeafTypes) == 0 &&
+		o.EncodeHook == nil && o.DecodeHook == nil &&
+		!o.DerefPointers && !o.OmitNilPointers && o.filter == nil &&
+		o.Coercion == CoerceNone && o.schema == nil
+}
+
+// ExpandPrefixedInto is like ExpandInto, but only expands the keys below
+// prefix, with prefix removed. A key equal to prefix is stored in dst as a
+// whole. Generated ExpandFrom methods use it for fields they cannot handle
+// without reflection.
+func ExpandPrefixedInto(flatMap map[string]interface{}, prefix string, dst interface{}, opts ...Option) error {
+	return expandPrefixedInto(flatMap, prefix, dst, newOptions(opts))
+}
+
+func expandPrefixedInto(flatMap map[string]interface{}, prefix string, dst interface{}, opts *Options) error {
+	if prefix == "" {
+		return expandInto(flatMap, dst, opts)
+	}
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return expandInto(nil, dst, opts)
+	}
+	if v, ok := flatMap[prefix]; ok {
+		return decode(v, rv.Elem(), prefix, opts)
+	}
+	base := prefix + opts.Sep
+	var sub map[string]interface{}
+	for key, v := range flatMap {
+		if rest, ok := strings.CutPrefix(key, base); ok {
+			if sub == nil {
+				sub = make(map[string]interface{})
+			}
+			sub[rest] = v
+		}
+	}
+	if sub == nil {
+		return nil
+	}
+	if me, ok := opts.mapExpanderFor(dst); ok {
+		return me.ExpandFrom(sub)
+	}
+	root, err := expand(sub, opts, false)
+	if err != nil || root == nil {
+		return err
+	}
+	return decode(root.build(opts), rv.Elem(), prefix, opts)
+}
+
+// DecodeInto stores src, a value built by Expand such as a nested map, a
+// slice or a leaf, in the value pointed to by dst, converting it as ExpandInto
+// would. path is the key src was found at, for errors. Generated ExpandFrom
+// methods use it for values they cannot convert themselves.
+func DecodeInto(src interface{}, path string, dst interface{}, opts ...Option) error {
+	return decodeInto(src, path, dst, newOptions(opts))
+}
+
+func decodeInto(src interface{}, path string, dst interface{}, opts *Options) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("bellows: DecodeInto requires a non-nil pointer, got %T", dst)
+	}
+	return decode(src, rv.Elem(), path, opts)
+}
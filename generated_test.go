@@ -0,0 +1,109 @@
+package bellows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// selfFlattening flattens itself under a marker key, so tests can tell
+// whether bellows used FlattenTo and ExpandFrom.
+type selfFlattening struct {
+	Value string
+}
+
+func (s selfFlattening) FlattenTo(m map[string]interface{}, prefix string) {
+	m[joinPath(prefix, "self", ".")] = s.Value
+}
+
+func (s *selfFlattening) ExpandFrom(flat map[string]interface{}) error {
+	s.Value, _ = flat["self"].(string)
+	return nil
+}
+
+type taggedSelfFlattening struct {
+	selfFlattening
+}
+
+func (taggedSelfFlattening) BellowsTagName() string { return "json" }
+
+func TestFlattenUsesMapFlattener(t *testing.T) {
+	input := map[string]interface{}{"a": []interface{}{selfFlattening{Value: "x"}}}
+	assert.Equal(t, map[string]interface{}{"a.[0].self": "x"}, Flatten(input))
+	assert.Equal(t, map[string]interface{}{"p.a.[0].self": "x"}, FlattenPrefixed(input, "p"))
+	assert.Equal(t, map[string]interface{}{"self": "x"}, NewFlattener().Flatten(&selfFlattening{Value: "x"}))
+
+	// Options the methods cannot honor fall back to reflection
+	assert.Equal(t, map[string]interface{}{"a/[0]/Value": "x"}, Flatten(input, WithSep("/")))
+	assert.Equal(t, map[string]interface{}{"Value": "x"}, Flatten(selfFlattening{Value: "x"}, WithTagName("json")))
+	assert.Equal(t, map[string]interface{}{"self": "x"}, Flatten(taggedSelfFlattening{selfFlattening{Value: "x"}}, WithTagName("json")))
+}
+
+func TestFlattenEIgnoresMapFlattener(t *testing.T) {
+	// FlattenTo cannot report errors, so FlattenE walks the value itself
+	flat, err := FlattenE(selfFlattening{Value: "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Value": "x"}, flat)
+
+	flat, err = NewFlattener().FlattenE(selfFlattening{Value: "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Value": "x"}, flat)
+}
+
+func TestExpandIntoUsesMapExpander(t *testing.T) {
+	var s selfFlattening
+	assert.NoError(t, ExpandInto(map[string]interface{}{"self": "x"}, &s))
+	assert.Equal(t, "x", s.Value)
+
+	s = selfFlattening{}
+	assert.NoError(t, ExpandInto(map[string]interface{}{"Value": "y"}, &s, WithMaxIndex(10)))
+	assert.Equal(t, "y", s.Value)
+
+	// ExpandFrom cannot keep the first of conflicting keys
+	s = selfFlattening{}
+	assert.NoError(t, ExpandInto(map[string]interface{}{"Value": "z"}, &s, WithConflictPolicy(ConflictFirstWins)))
+	assert.Equal(t, "z", s.Value)
+
+	// Nor coerce values
+	s = selfFlattening{}
+	assert.NoError(t, ExpandInto(map[string]interface{}{"Value": "v"}, &s, WithCoercion(CoerceYAML)))
+	assert.Equal(t, "v", s.Value)
+}
+
+func TestDecodeInto(t *testing.T) {
+	var dst struct {
+		Host  string
+		Ports []int
+	}
+	src := map[string]interface{}{"Host": "localhost", "Ports": []interface{}{"5432"}}
+	assert.NoError(t, DecodeInto(src, "db", &dst))
+	assert.Equal(t, "localhost", dst.Host)
+	assert.Equal(t, []int{5432}, dst.Ports)
+
+	var port int
+	assert.EqualError(t, NewExpander().DecodeInto("x", "db.port", &port), `bellows: cannot expand string into int at "db.port"`)
+	assert.EqualError(t, DecodeInto("x", "", port), "bellows: DecodeInto requires a non-nil pointer, got int")
+}
+
+func TestExpandPrefixedInto(t *testing.T) {
+	flat := map[string]interface{}{
+		"db.Host":      "localhost",
+		"db.Ports.[0]": 5432,
+		"name":         "app",
+	}
+	var db struct {
+		Host  string
+		Ports []int
+	}
+	assert.NoError(t, ExpandPrefixedInto(flat, "db", &db))
+	assert.Equal(t, "localhost", db.Host)
+	assert.Equal(t, []int{5432}, db.Ports)
+
+	var name string
+	assert.NoError(t, ExpandPrefixedInto(flat, "name", &name))
+	assert.Equal(t, "app", name)
+
+	var port int
+	err := ExpandPrefixedInto(map[string]interface{}{"port": "x"}, "port", &port)
+	assert.EqualError(t, err, `bellows: cannot expand string into int at "port"`)
+}
@@ -0,0 +1,32 @@
+package bellows
+
+import (
+	"reflect"
+)
+
+// EncodeHook lets callers replace the value found at path while flattening.
+// If handled is true, value is stored at path as a leaf and v is not walked
+// any further; otherwise Flatten carries on as usual. path is the full key,
+// built from the prefix and separator. v is the zero Value for nil.
+type EncodeHook func(path string, v reflect.Value) (value interface{}, handled bool, err error)
+
+// DecodeHook lets callers convert the expanded value found at path before
+// ExpandInto stores it in a destination of type t. If handled is true, value
+// is stored instead of v, converted as needed.
+type DecodeHook func(path string, v interface{}, t reflect.Type) (value interface{}, handled bool, err error)
+
+// WithEncodeHook sets a hook called by Flatten for every value below the
+// root, including maps, slices and structs before they are walked.
+func WithEncodeHook(hook EncodeHook) Option {
+	return func(o *Options) {
+		o.EncodeHook = hook
+	}
+}
+
+// WithDecodeHook sets a hook called by ExpandInto for every value below the
+// root before it is stored.
+func WithDecodeHook(hook DecodeHook) Option {
+	return func(o *Options) {
+		o.DecodeHook = hook
+	}
+}
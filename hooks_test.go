@@ -0,0 +1,114 @@
+package bellows
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type hookConfig struct {
+	Timeout  time.Duration
+	Retry    *time.Duration
+	Database struct {
+		User     string
+		Password string
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func durationEncodeHook(path string, v reflect.Value) (interface{}, bool, error) {
+	if strings.HasSuffix(path, "Password") {
+		return "***", true, nil
+	}
+	if v.IsValid() && v.Type() == durationType {
+		return v.Interface().(time.Duration).String(), true, nil
+	}
+	return nil, false, nil
+}
+
+func durationDecodeHook(path string, v interface{}, t reflect.Type) (interface{}, bool, error) {
+	s, ok := v.(string)
+	if !ok || t != durationType {
+		return nil, false, nil
+	}
+	d, err := time.ParseDuration(s)
+	return d, true, err
+}
+
+func TestFlattenEncodeHook(t *testing.T) {
+	retry := 2 * time.Second
+	input := hookConfig{Timeout: 5 * time.Second, Retry: &retry}
+	input.Database.User = "admin"
+	input.Database.Password = "hunter2"
+
+	result := Flatten(input, WithEncodeHook(durationEncodeHook), WithPrefix("app"))
+	assert.Equal(t, map[string]interface{}{
+		"app.Timeout":           "5s",
+		"app.Retry":             &retry,
+		"app.Database.User":     "admin",
+		"app.Database.Password": "***",
+	}, result)
+}
+
+func TestFlattenEncodeHookPaths(t *testing.T) {
+	var paths []string
+	hook := func(path string, v reflect.Value) (interface{}, bool, error) {
+		paths = append(paths, path)
+		return nil, false, nil
+	}
+	Flatten(map[string]interface{}{"a": []int{1}}, WithEncodeHook(hook), WithSep("/"))
+	assert.Equal(t, []string{"a", "a/[0]"}, paths)
+}
+
+func TestFlattenEncodeHookError(t *testing.T) {
+	errSecret := errors.New("secret found")
+	hook := func(path string, v reflect.Value) (interface{}, bool, error) {
+		if path == "Database.Password" {
+			return nil, false, errSecret
+		}
+		return nil, false, nil
+	}
+	_, err := FlattenE(hookConfig{}, WithEncodeHook(hook))
+	assert.ErrorIs(t, err, errSecret)
+	assert.EqualError(t, err, `bellows: encode hook failed at "Database.Password": secret found`)
+}
+
+func TestExpandIntoDecodeHook(t *testing.T) {
+	input := map[string]interface{}{
+		"Timeout":       "5s",
+		"Retry":         "250ms",
+		"Database.User": "admin",
+	}
+	var result hookConfig
+	err := ExpandInto(input, &result, WithDecodeHook(durationDecodeHook))
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, result.Timeout)
+	assert.Equal(t, 250*time.Millisecond, *result.Retry)
+	assert.Equal(t, "admin", result.Database.User)
+
+	err = ExpandInto(map[string]interface{}{"Timeout": "soon"}, &result, WithDecodeHook(durationDecodeHook))
+	assert.ErrorContains(t, err, `bellows: decode hook failed at "Timeout"`)
+}
+
+func TestHooksRoundTrip(t *testing.T) {
+	retry := time.Minute
+	input := hookConfig{Timeout: 90 * time.Second, Retry: &retry}
+	flat := Flatten(input, WithEncodeHook(func(path string, v reflect.Value) (interface{}, bool, error) {
+		if v.IsValid() && v.Kind() == reflect.Ptr && v.Type().Elem() == durationType {
+			return v.Elem().Interface().(time.Duration).String(), true, nil
+		}
+		return durationEncodeHook(path, v)
+	}))
+	assert.Equal(t, "1m0s", flat["Retry"])
+
+	var result hookConfig
+	assert.NoError(t, ExpandInto(flat, &result, WithDecodeHook(durationDecodeHook)))
+	assert.Equal(t, input.Timeout, result.Timeout)
+	assert.Equal(t, retry, *result.Retry)
+	assert.Equal(t, "***", result.Database.Password)
+}
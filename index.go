@@ -0,0 +1,99 @@
+package bellows
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkIndexes validates the index segments of key, parsed into path, against
+// WithStrictIndex and WithMaxIndex.
+func (o *Options) checkIndexes(key string, path []segment) error {
+	start := 0
+	for i, seg := range path {
+		if i > 0 && strings.HasPrefix(key[path[i-1].end:], o.Sep) {
+			start = path[i-1].end + len(o.Sep)
+		} else if i > 0 {
+			start = path[i-1].end
+		}
+		switch seg.kind {
+		case indexSegment:
+			if o.MaxIndex > 0 && seg.index > o.MaxIndex {
+				reason := fmt.Sprintf("index %d exceeds max index %d", seg.index, o.MaxIndex)
+				return &IndexError{Path: key[:seg.end], Key: key, Reason: reason}
+			}
+		case keySegment:
+			if !o.StrictIndex {
+				continue
+			}
+			if reason := o.indexProblem(key[start:seg.end]); reason != "" {
+				return &IndexError{Path: key[:seg.end], Key: key, Reason: reason}
+			}
+		}
+	}
+	return nil
+}
+
+// indexProblem describes why raw, the text of a key segment, looks like a
+// botched index, or returns "" if it is a proper key.
+func (o *Options) indexProblem(raw string) string {
+	// Numbers that are not canonical indexes are ambiguous in IndexDot
+	if o.IndexStyle == IndexDot && raw != "" && (raw[0] == '-' || raw[0] == '0') &&
+		isAllDigits(strings.TrimPrefix(raw, "-")) {
+		return "ambiguous numeric segment " + raw
+	}
+	if !o.hasUnescapedBracket(raw) {
+		return ""
+	}
+
+	open, end := strings.IndexByte(raw, '['), strings.IndexByte(raw, ']')
+	if open < 0 || end < open {
+		return "unbalanced brackets in " + raw
+	}
+	group := raw[open+1 : end]
+	_, isIndex := parseIndex(group)
+	switch {
+	case group == "":
+		return "empty index in " + raw
+	case group[0] == '-' && isAllDigits(group[1:]):
+		return "negative index in " + raw
+	case !isAllDigits(group):
+		return "non-numeric index in " + raw
+	case !isIndex:
+		return "index out of range in " + raw
+	}
+	return "index mixed with key in " + raw
+}
+
+func isAllDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// checkSparsity removes slices below n that are sparser than WithMaxSparsity
+// allows, reporting each in an *IndexError, and returns what is left of n.
+func (e *expansion) checkSparsity(n *node) *node {
+	switch n.kind {
+	case mapNode:
+		for k, child := range n.fields {
+			if child = e.checkSparsity(child); child == nil {
+				delete(n.fields, k)
+			}
+		}
+	case sliceNode:
+		if float64(n.size) > e.opts.MaxSparsity*float64(len(n.items)) {
+			reason := fmt.Sprintf("%d of %d items set exceeds max sparsity %g", len(n.items), n.size, e.opts.MaxSparsity)
+			e.sparse = append(e.sparse, &IndexError{Path: n.lastPath, Key: n.lastKey, Reason: reason})
+			return nil
+		}
+		for i, child := range n.items {
+			if child = e.checkSparsity(child); child == nil {
+				delete(n.items, i)
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,122 @@
+package bellows
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandStrictIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		key    string
+		path   string
+		reason string
+	}{
+		{name: "mixed", key: "items.foo[3]bar", path: "items.foo[3]bar", reason: "index mixed with key in foo[3]bar"},
+		{name: "non-numeric", key: "items.[abc]", path: "items.[abc]", reason: "non-numeric index in [abc]"},
+		{name: "negative", key: "items.[-1].name", path: "items.[-1]", reason: "negative index in [-1]"},
+		{name: "empty", key: "items.[]", path: "items.[]", reason: "empty index in []"},
+		{name: "unbalanced", key: "items.[1", path: "items.[1", reason: "unbalanced brackets in [1"},
+		{
+			name:   "bracket style negative",
+			opts:   []Option{WithIndexStyle(IndexBracket)},
+			key:    "items[-1]",
+			path:   "items[-1]",
+			reason: "negative index in items[-1]",
+		},
+		{
+			name:   "dot style leading zero",
+			opts:   []Option{WithIndexStyle(IndexDot)},
+			key:    "items.01",
+			path:   "items.01",
+			reason: "ambiguous numeric segment 01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := map[string]interface{}{tt.key: "bad", "ok": "value"}
+			opts := append([]Option{WithStrictIndex()}, tt.opts...)
+
+			result, err := ExpandE(input, opts...)
+			assert.Nil(t, result)
+			var indexErr *IndexError
+			if assert.True(t, errors.As(err, &indexErr)) {
+				assert.Equal(t, tt.path, indexErr.Path)
+				assert.Equal(t, tt.key, indexErr.Key)
+				assert.Equal(t, tt.reason, indexErr.Reason)
+			}
+
+			assert.Equal(t, map[string]interface{}{"ok": "value"}, Expand(input, opts...))
+		})
+	}
+}
+
+func TestExpandLenientIndex(t *testing.T) {
+	input := map[string]interface{}{"items.a[0]": "first", "items.foo[1]bar": "mixed", "keys.[x]": "key"}
+	expected := map[string]interface{}{
+		"items": []interface{}{"first", "mixed"},
+		"keys":  map[string]interface{}{"[x]": "key"},
+	}
+	assert.Equal(t, expected, Expand(input))
+}
+
+func TestExpandStrictIndexAllowsEscapedBrackets(t *testing.T) {
+	input := map[string]interface{}{`a.\[x\]`: 1, "b.[0]": 2}
+	result, err := ExpandE(input, WithStrictIndex(), WithEscaping())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{"[x]": 1},
+		"b": []interface{}{2},
+	}, result)
+}
+
+func TestExpandMaxIndex(t *testing.T) {
+	input := map[string]interface{}{
+		"a.[2]":         "ok",
+		"b.[999999999]": "huge",
+	}
+	_, err := ExpandE(input, WithMaxIndex(100))
+	var indexErr *IndexError
+	if assert.True(t, errors.As(err, &indexErr)) {
+		assert.Equal(t, "b.[999999999]", indexErr.Path)
+		assert.Equal(t, "index 999999999 exceeds max index 100", indexErr.Reason)
+	}
+	assert.EqualError(t, err, `bellows: invalid index at path "b.[999999999]" of key "b.[999999999]": index 999999999 exceeds max index 100`)
+
+	assert.Equal(t, map[string]interface{}{
+		"a": []interface{}{nil, nil, "ok"},
+	}, Expand(input, WithMaxIndex(100)))
+}
+
+func TestExpandMaxSparsity(t *testing.T) {
+	input := map[string]interface{}{
+		"dense.[0]":        "a",
+		"dense.[1]":        "b",
+		"sparse.[0]":       "a",
+		"sparse.[9]":       "b",
+		"nested.[0].[0]":   1,
+		"nested.[0].[500]": 2,
+	}
+	result, err := ExpandE(input, WithMaxSparsity(4))
+	assert.Nil(t, result)
+	var indexErrs []*IndexError
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var indexErr *IndexError
+		if errors.As(e, &indexErr) {
+			indexErrs = append(indexErrs, indexErr)
+		}
+	}
+	if assert.Len(t, indexErrs, 2) {
+		assert.Equal(t, "nested.[0].[500]", indexErrs[0].Path)
+		assert.Equal(t, "sparse.[9]", indexErrs[1].Path)
+		assert.Equal(t, "2 of 10 items set exceeds max sparsity 4", indexErrs[1].Reason)
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"dense":  []interface{}{"a", "b"},
+		"nested": []interface{}{nil},
+	}, Expand(input, WithMaxSparsity(4)))
+}
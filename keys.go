@@ -0,0 +1,71 @@
+package bellows
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// formatMapKey returns the string form of a map key. String kinds are used
+// directly, then encoding.TextMarshaler, fmt.Stringer and strconv for
+// integer, float and bool kinds are tried in turn.
+func formatMapKey(k reflect.Value) (string, bool) {
+	if k.Kind() == reflect.Interface {
+		k = k.Elem()
+	}
+	if !k.IsValid() {
+		return "", false
+	}
+	if k.Kind() == reflect.String {
+		return k.String(), true
+	}
+	if k.Kind() == reflect.Ptr && k.IsNil() {
+		return "", false
+	}
+	switch v := k.Interface().(type) {
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return "", false
+		}
+		return string(text), true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(k.Float(), 'g', -1, k.Type().Bits()), true
+	case reflect.Bool:
+		return strconv.FormatBool(k.Bool()), true
+	}
+	return "", false
+}
+
+// parseMapKey is the inverse of formatMapKey for a map key of type t.
+func parseMapKey(s string, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.String {
+		return reflect.ValueOf(s).Convert(t), nil
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		k := reflect.New(t)
+		if err := k.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return reflect.Value{}, err
+		}
+		return k.Elem(), nil
+	}
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		return reflect.ValueOf(s), nil
+	}
+	k := reflect.New(t).Elem()
+	if !convertScalar(reflect.ValueOf(s), k) {
+		return reflect.Value{}, fmt.Errorf("cannot parse %q as %s", s, t)
+	}
+	return k, nil
+}
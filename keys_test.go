@@ -0,0 +1,78 @@
+package bellows
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type keyColor int
+
+func (c keyColor) String() string {
+	return [...]string{"red", "green"}[c]
+}
+
+type keyLevel int
+
+func (l keyLevel) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("level-%d", int(l))), nil
+}
+
+func (l *keyLevel) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "level-%d", (*int)(l))
+	return err
+}
+
+func TestFlattenNonStringKeys(t *testing.T) {
+	addr := netip.MustParseAddr("10.0.0.1")
+	input := map[string]interface{}{
+		"ints":   map[int]string{1: "one", -2: "minus two"},
+		"uints":  map[uint8]bool{7: true},
+		"bools":  map[bool]int{true: 1},
+		"floats": map[float64]string{1.5: "x"},
+		"colors": map[keyColor]int{0: 10, 1: 20},
+		"levels": map[keyLevel]string{3: "high"},
+		"addrs":  map[netip.Addr]int{addr: 80},
+		"any":    map[interface{}]int{"s": 1, 2: 2},
+	}
+	expected := map[string]interface{}{
+		"ints.1":         "one",
+		"ints.-2":        "minus two",
+		"uints.7":        true,
+		"bools.true":     1,
+		"floats.1.5":     "x",
+		"colors.red":     10,
+		"colors.green":   20,
+		"levels.level-3": "high",
+		"addrs.10.0.0.1": 80,
+		"any.s":          1,
+		"any.2":          2,
+	}
+	assert.Equal(t, expected, Flatten(input))
+}
+
+func TestExpandIntoNonStringKeys(t *testing.T) {
+	type Config struct {
+		Ports  map[int]string
+		Levels map[keyLevel]bool
+		Flags  map[bool]string
+	}
+	input := Config{
+		Ports:  map[int]string{80: "http", 443: "https"},
+		Levels: map[keyLevel]bool{1: true, 2: false},
+		Flags:  map[bool]string{true: "on"},
+	}
+
+	var result Config
+	err := ExpandInto(Flatten(input), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, input, result)
+}
+
+func TestExpandIntoInvalidMapKey(t *testing.T) {
+	var result map[int]string
+	err := ExpandInto(map[string]interface{}{"x": "y"}, &result)
+	assert.EqualError(t, err, `bellows: cannot expand key at "x": cannot parse "x" as int`)
+}
@@ -0,0 +1,69 @@
+package bellows
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// LeafInterfaces is a set of interfaces whose implementations Flatten stores
+// as single leaf values, such as time.Time, *big.Int or net.IP, instead of
+// walking into their fields or elements.
+type LeafInterfaces uint8
+
+const (
+	// LeafTextMarshaler matches encoding.TextMarshaler implementations.
+	LeafTextMarshaler LeafInterfaces = 1 << iota
+	// LeafJSONMarshaler matches json.Marshaler implementations.
+	LeafJSONMarshaler
+	// LeafStringer matches fmt.Stringer implementations.
+	LeafStringer
+)
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// isLeafType reports whether values of type t are stored whole. Methods with
+// pointer receivers count too, since Flatten keeps the original pointer.
+func (o *Options) isLeafType(t reflect.Type) bool {
+	if len(o.LeafTypes) > 0 {
+		return o.isLeafValueType(t) || o.isLeafValueType(reflect.PointerTo(t))
+	}
+	// Without WithLeafTypes the answer only depends on t and the interfaces
+	key := leafCacheKey{t: t, interfaces: o.LeafInterfaces}
+	if leaf, ok := leafCache.Load(key); ok {
+		return leaf.(bool)
+	}
+	leaf := o.isLeafValueType(t) || o.isLeafValueType(reflect.PointerTo(t))
+	leafCache.Store(key, leaf)
+	return leaf
+}
+
+type leafCacheKey struct {
+	t          reflect.Type
+	interfaces LeafInterfaces
+}
+
+// leafCache holds the isLeafType decisions made without WithLeafTypes.
+var leafCache sync.Map // leafCacheKey -> bool
+
+// isLeafValueType is like isLeafType, but only considers the method set of t
+// itself.
+func (o *Options) isLeafValueType(t reflect.Type) bool {
+	if o.LeafTypes[t] {
+		return true
+	}
+	for lt := range o.LeafTypes {
+		if lt.Kind() == reflect.Interface && t.Implements(lt) {
+			return true
+		}
+	}
+	return (o.LeafInterfaces&LeafTextMarshaler != 0 && t.Implements(textMarshalerType)) ||
+		(o.LeafInterfaces&LeafJSONMarshaler != 0 && t.Implements(jsonMarshalerType)) ||
+		(o.LeafInterfaces&LeafStringer != 0 && t.Implements(stringerType))
+}
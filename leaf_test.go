@@ -0,0 +1,118 @@
+package bellows
+
+import (
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type leafEvent struct {
+	Name    string
+	At      time.Time
+	Amount  *big.Int
+	Source  net.IP
+	Money   leafMoney
+	Version leafVersion
+}
+
+type leafMoney struct {
+	Units int64
+	Nanos int32
+}
+
+type leafVersion struct {
+	Major, Minor int
+}
+
+func (v leafVersion) String() string {
+	return "v1"
+}
+
+func (m leafMoney) MarshalJSON() ([]byte, error) {
+	return []byte(`"1.00"`), nil
+}
+
+func TestFlattenLeafTypes(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	input := leafEvent{
+		Name:    "deposit",
+		At:      at,
+		Amount:  big.NewInt(42),
+		Source:  net.ParseIP("10.0.0.1"),
+		Money:   leafMoney{Units: 1},
+		Version: leafVersion{Major: 1},
+	}
+	expected := map[string]interface{}{
+		"Name":          "deposit",
+		"At":            at,
+		"Amount":        big.NewInt(42),
+		"Source":        net.ParseIP("10.0.0.1"),
+		"Money.Units":   int64(1),
+		"Money.Nanos":   int32(0),
+		"Version.Major": 1,
+		"Version.Minor": 0,
+	}
+	assert.Equal(t, expected, Flatten(input))
+}
+
+func TestFlattenLeafInterfaces(t *testing.T) {
+	input := leafEvent{Money: leafMoney{Units: 1}, Version: leafVersion{Major: 1}}
+	result := Flatten(input, WithLeafInterfaces(LeafJSONMarshaler|LeafStringer))
+	assert.Equal(t, leafMoney{Units: 1}, result["Money"])
+	assert.Equal(t, leafVersion{Major: 1}, result["Version"])
+
+	// Without any leaf interfaces, time.Time has no exported fields to walk
+	result = Flatten(input, WithLeafInterfaces(0))
+	assert.NotContains(t, result, "At")
+}
+
+func TestFlattenRegisteredLeafTypes(t *testing.T) {
+	input := leafEvent{Money: leafMoney{Units: 1}}
+	result := Flatten(input, WithLeafTypes(reflect.TypeOf(leafMoney{})))
+	assert.Equal(t, leafMoney{Units: 1}, result["Money"])
+	assert.Contains(t, result, "Version.Major")
+
+	stringer := reflect.TypeOf((*interface{ String() string })(nil)).Elem()
+	result = Flatten(input, WithLeafTypes(stringer))
+	assert.Equal(t, leafVersion{}, result["Version"])
+}
+
+func TestExpandIntoLeafTypes(t *testing.T) {
+	input := leafEvent{
+		Name:   "deposit",
+		At:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Amount: big.NewInt(42),
+		Source: net.ParseIP("10.0.0.1"),
+	}
+	var result leafEvent
+	assert.NoError(t, ExpandInto(Flatten(input), &result))
+	assert.Equal(t, input, result)
+
+	var parsed leafEvent
+	err := ExpandInto(map[string]interface{}{
+		"At":     "2024-05-01T12:00:00Z",
+		"Amount": "42",
+		"Source": "10.0.0.1",
+	}, &parsed)
+	assert.NoError(t, err)
+	assert.True(t, input.At.Equal(parsed.At))
+	assert.Equal(t, input.Amount, parsed.Amount)
+	assert.Equal(t, input.Source.String(), parsed.Source.String())
+
+	err = ExpandInto(map[string]interface{}{"At": "yesterday"}, &parsed)
+	assert.Error(t, err)
+}
+
+func TestFlattenDerefLeafTypes(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	amount := big.NewInt(42)
+	input := map[string]interface{}{"at": &at, "amount": amount}
+	assert.Equal(t, map[string]interface{}{
+		"at":     at,
+		"amount": amount,
+	}, Flatten(input, WithDerefPointers()))
+}
@@ -1,20 +1,320 @@
 package bellows
 
-type bellowsOptions struct {
-	prefix string
-	sep    string
+import (
+	"reflect"
+	"sync"
+)
+
+// Options configures Flatten, Expand and the other entry points. Each field
+// is set by the With function of the same name, so custom options can be
+// written as Option values that change several fields at once.
+type Options struct {
+	// Prefix is prepended to every flattened key.
+	Prefix string
+	// Sep separates the segments of flat keys, "." by default.
+	Sep string
+	// TagName is the struct tag that keys struct fields, see WithTagName.
+	TagName string
+
+	ConflictPolicy ConflictPolicy
+	CyclePolicy    CyclePolicy
+	MaxDepth       int
+	DepthPolicy    DepthPolicy
+	IndexStyle     IndexStyle
+	Escaping       bool
+
+	StrictIndex bool
+	MaxIndex    int
+	MaxSparsity float64
+
+	SparsePolicy SparsePolicy
+	NilGaps      bool
+
+	EmptyContainers bool
+	StringKeysOnly  bool
+
+	// LeafInterfaces is LeafTextMarshaler by default.
+	LeafInterfaces LeafInterfaces
+	LeafTypes      map[reflect.Type]bool
+
+	EncodeHook EncodeHook
+	DecodeHook DecodeHook
+
+	DerefPointers   bool
+	OmitNilPointers bool
+
+	Include []string
+	Exclude []string
+	filter  *filter
+
+	Coercion     Coercion
+	ScalarSchema map[string]ScalarType
+	schema       []schemaRule
+
+	plans *sync.Map // reflect.Type -> *typePlan
+	// plain reports isPlain, see MapFlattener.
+	plain bool
+}
+
+// Option changes one or more fields of Options.
+type Option func(o *Options)
+
+func newOptions(opts []Option) *Options {
+	options := &Options{
+		Prefix:         "",
+		Sep:            ".",
+		LeafInterfaces: LeafTextMarshaler,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	options.filter = options.compileFilter()
+	options.schema = options.compileSchema()
+	options.plain = options.isPlain()
+	return options
+}
+
+// WithPrefix prepends prefix and the separator to every flattened key.
+func WithPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.Prefix = prefix
+	}
+}
+
+// WithSep sets the separator between key segments, "." by default.
+func WithSep(sep string) Option {
+	return func(o *Options) {
+		o.Sep = sep
+	}
+}
+
+// WithTagName keys struct fields by the named struct tag (e.g. "json"),
+// honoring "-", "omitempty" and "inline"/"squash".
+func WithTagName(tagName string) Option {
+	return func(o *Options) {
+		o.TagName = tagName
+	}
 }
 
-type option func(o *bellowsOptions)
+// ConflictPolicy decides what happens when two flat keys disagree on the shape
+// of the same path during expansion.
+type ConflictPolicy int
+
+const (
+	// ConflictFail rejects every conflicting key and reports it in the
+	// error returned by ExpandE.
+	ConflictFail ConflictPolicy = iota
+	// ConflictFirstWins keeps the shape given by the first key in sorted order.
+	ConflictFirstWins
+	// ConflictLastWins keeps the shape given by the last key in sorted order.
+	ConflictLastWins
+	// ConflictScalarWins keeps scalar values over maps and slices.
+	ConflictScalarWins
+	// ConflictContainerWins keeps maps and slices over scalar values.
+	ConflictContainerWins
+)
+
+// WithConflictPolicy sets how ExpandE resolves conflicting keys.
+func WithConflictPolicy(policy ConflictPolicy) Option {
+	return func(o *Options) {
+		o.ConflictPolicy = policy
+	}
+}
+
+// CyclePolicy decides what Flatten does with a pointer, map or slice that
+// refers back to one of its ancestors.
+type CyclePolicy int
+
+const (
+	// CycleFail stops flattening with a *CycleError naming the cyclic path.
+	CycleFail CyclePolicy = iota
+	// CycleRef stores the ancestor's path under a "$ref" key below the
+	// cyclic path, like a JSON reference.
+	CycleRef
+	// CycleSkip leaves the cyclic path out of the result.
+	CycleSkip
+)
+
+// WithCyclePolicy sets how Flatten handles self-referential values.
+func WithCyclePolicy(policy CyclePolicy) Option {
+	return func(o *Options) {
+		o.CyclePolicy = policy
+	}
+}
+
+// DepthPolicy decides what Flatten does with a map, slice or struct found at
+// the depth limit set by WithMaxDepth.
+type DepthPolicy int
+
+const (
+	// DepthFail stops flattening with a *DepthError.
+	DepthFail DepthPolicy = iota
+	// DepthLeaf stores the remaining subtree unflattened as a leaf value.
+	DepthLeaf
+)
+
+// WithMaxDepth limits keys to n segments, counting those of WithPrefix or the
+// prefix passed to FlattenPrefixed. Flatten handles deeper values according
+// to WithDepthPolicy and Expand rejects longer keys. Zero means no limit.
+func WithMaxDepth(n int) Option {
+	return func(o *Options) {
+		o.MaxDepth = n
+	}
+}
+
+// WithDepthPolicy sets how Flatten handles values nested beyond WithMaxDepth.
+func WithDepthPolicy(policy DepthPolicy) Option {
+	return func(o *Options) {
+		o.DepthPolicy = policy
+	}
+}
+
+// WithIndexStyle sets the syntax of slice and array indexes in flat keys,
+// for both Flatten and Expand.
+func WithIndexStyle(style IndexStyle) Option {
+	return func(o *Options) {
+		o.IndexStyle = style
+	}
+}
+
+// WithStrictIndex makes Expand reject keys with malformed index segments,
+// such as "foo[3]bar", "[abc]" or "[-1]", instead of reading them as map keys.
+// ExpandE reports them in an *IndexError.
+func WithStrictIndex() Option {
+	return func(o *Options) {
+		o.StrictIndex = true
+	}
+}
+
+// WithMaxIndex makes Expand reject keys with an index above n, so untrusted
+// keys such as "a.[999999999]" cannot allocate huge slices. Zero means no
+// limit.
+func WithMaxIndex(n int) Option {
+	return func(o *Options) {
+		o.MaxIndex = n
+	}
+}
+
+// WithMaxSparsity makes Expand reject slices whose length is more than ratio
+// times the number of items actually given, e.g. with a ratio of 4 a slice
+// with items at "[0]" and "[9]" is rejected. Zero means no limit.
+func WithMaxSparsity(ratio float64) Option {
+	return func(o *Options) {
+		o.MaxSparsity = ratio
+	}
+}
+
+// SparsePolicy decides how Expand builds slices whose indexes leave gaps,
+// such as "list.[0]" and "list.[1000]".
+type SparsePolicy int
+
+const (
+	// SparseFill builds a slice up to the highest index, filling gaps with
+	// empty maps or slices shaped like the next item, or nil with
+	// WithNilGaps.
+	SparseFill SparsePolicy = iota
+	// SparseIndexMap builds a map[int]interface{} holding only the indexes
+	// given. Slices without gaps are still built as slices.
+	SparseIndexMap
+	// SparseCompact builds a slice of the given items in index order,
+	// dropping the gaps.
+	SparseCompact
+)
+
+// WithSparsePolicy sets how Expand builds slices with gaps between indexes.
+func WithSparsePolicy(policy SparsePolicy) Option {
+	return func(o *Options) {
+		o.SparsePolicy = policy
+	}
+}
+
+// WithNilGaps makes Expand fill gaps in slices with nil instead of empty
+// maps or slices, so absent items can be told apart from empty ones.
+func WithNilGaps() Option {
+	return func(o *Options) {
+		o.NilGaps = true
+	}
+}
+
+// WithEscaping makes Flatten backslash-escape separators, brackets and
+// backslashes inside map keys and field names, and makes Expand honor those
+// escapes, so keys such as "example.com" survive a round trip.
+func WithEscaping() Option {
+	return func(o *Options) {
+		o.Escaping = true
+	}
+}
+
+// WithEmptyContainers makes Flatten store empty maps and slices as
+// map[string]interface{}{} and []interface{}{} leaves, and nil ones as nil,
+// instead of leaving no key behind. Expand restores them as containers.
+func WithEmptyContainers() Option {
+	return func(o *Options) {
+		o.EmptyContainers = true
+	}
+}
+
+// WithStringKeysOnly makes Flatten skip maps whose keys are not of a string
+// kind, instead of formatting their keys.
+func WithStringKeysOnly() Option {
+	return func(o *Options) {
+		o.StringKeysOnly = true
+	}
+}
+
+// WithLeafInterfaces sets which interfaces make Flatten store a value as a
+// single leaf instead of walking into it. The default is LeafTextMarshaler.
+func WithLeafInterfaces(interfaces LeafInterfaces) Option {
+	return func(o *Options) {
+		o.LeafInterfaces = interfaces
+	}
+}
+
+// WithLeafTypes registers types that Flatten stores as single leaf values
+// instead of walking into them. Interface types match their implementations.
+func WithLeafTypes(types ...reflect.Type) Option {
+	return func(o *Options) {
+		if o.LeafTypes == nil {
+			o.LeafTypes = make(map[reflect.Type]bool, len(types))
+		}
+		for _, t := range types {
+			o.LeafTypes[t] = true
+		}
+	}
+}
+
+// WithDerefPointers makes Flatten store the values that pointers point to at
+// leaves, instead of the pointers themselves. Leaf types whose marshaling
+// methods need a pointer receiver, such as *big.Int, keep their pointer.
+func WithDerefPointers() Option {
+	return func(o *Options) {
+		o.DerefPointers = true
+	}
+}
+
+// WithOmitNilPointers makes Flatten leave out nil pointers instead of storing
+// nil.
+func WithOmitNilPointers() Option {
+	return func(o *Options) {
+		o.OmitNilPointers = true
+	}
+}
 
-func WithPrefix(prefix string) option {
-	return func(o *bellowsOptions) {
-		o.prefix = prefix
+// WithInclude limits Flatten and Expand to keys matching at least one of the
+// patterns, or lying below a match. Patterns use the configured separator and
+// index style, with "*" matching one segment, "**" any number of segments
+// and "[*]" any index, e.g. "database.*" or "services.[*].name". Flatten
+// prunes subtrees that cannot match while walking.
+func WithInclude(patterns ...string) Option {
+	return func(o *Options) {
+		o.Include = append(o.Include, patterns...)
 	}
 }
 
-func WithSep(sep string) option {
-	return func(o *bellowsOptions) {
-		o.sep = sep
+// WithExclude drops keys matching any of the patterns, or lying below a
+// match, from Flatten and Expand. See WithInclude for the pattern syntax.
+func WithExclude(patterns ...string) Option {
+	return func(o *Options) {
+		o.Exclude = append(o.Exclude, patterns...)
 	}
 }
@@ -0,0 +1,42 @@
+package bellows
+
+// KV is a flat key and its leaf value.
+type KV struct {
+	Key   string
+	Value interface{}
+}
+
+// FlatList is a flat representation that keeps the natural order of the
+// flattened value: struct fields in declaration order, slice items in index
+// order and map keys sorted.
+type FlatList []KV
+
+// Map returns the list as a flat map. Later entries win over earlier ones
+// with the same key.
+func (l FlatList) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(l))
+	for _, kv := range l {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+// FlattenOrdered is like Flatten, but returns the keys in the natural order
+// of value, which keeps generated files and dumps stable and diff-friendly.
+func FlattenOrdered(value interface{}, opts ...Option) FlatList {
+	options := newOptions(opts)
+	list := make(FlatList, 0, 5)
+	w := newWalker(options, options.Prefix, func(key string, v interface{}) error {
+		list = append(list, KV{Key: key, Value: v})
+		return nil
+	})
+	w.sortKeys = true
+	_ = w.run(value)
+	return list
+}
+
+// ExpandList is like Expand, but takes a FlatList such as the one returned
+// by FlattenOrdered.
+func ExpandList(list FlatList, opts ...Option) interface{} {
+	return Expand(list.Map(), opts...)
+}
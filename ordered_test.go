@@ -0,0 +1,61 @@
+package bellows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlattenOrdered(t *testing.T) {
+	type Service struct {
+		Name   string
+		Ports  []int
+		Labels map[string]string
+		Zone   string
+	}
+	input := Service{
+		Name:  "api",
+		Ports: []int{80, 443},
+		Labels: map[string]string{
+			"tier":    "web",
+			"app":     "api",
+			"shard10": "x",
+			"shard2":  "y",
+		},
+		Zone: "eu",
+	}
+	expected := FlatList{
+		{Key: "Name", Value: "api"},
+		{Key: "Ports.[0]", Value: 80},
+		{Key: "Ports.[1]", Value: 443},
+		{Key: "Labels.app", Value: "api"},
+		{Key: "Labels.shard2", Value: "y"},
+		{Key: "Labels.shard10", Value: "x"},
+		{Key: "Labels.tier", Value: "web"},
+		{Key: "Zone", Value: "eu"},
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, expected, FlattenOrdered(input))
+	}
+	assert.Equal(t, Flatten(input), expected.Map())
+}
+
+func TestFlattenOrderedNonStringKeys(t *testing.T) {
+	input := map[int]string{10: "ten", 2: "two", 1: "one"}
+	expected := FlatList{
+		{Key: "n.1", Value: "one"},
+		{Key: "n.2", Value: "two"},
+		{Key: "n.10", Value: "ten"},
+	}
+	assert.Equal(t, expected, FlattenOrdered(input, WithPrefix("n")))
+}
+
+func TestExpandList(t *testing.T) {
+	list := FlattenOrdered(example)
+	assert.Equal(t, Expand(Flatten(example)), ExpandList(list))
+
+	assert.Equal(t, map[string]interface{}{"a": 2}, ExpandList(FlatList{
+		{Key: "a", Value: 1},
+		{Key: "a", Value: 2},
+	}))
+}
@@ -0,0 +1,300 @@
+package bellows
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IndexStyle is the syntax used for slice and array indexes in flat keys.
+type IndexStyle int
+
+const (
+	// IndexDotBracket writes indexes as separate bracketed segments, e.g.
+	// "parent.[0]".
+	IndexDotBracket IndexStyle = iota
+	// IndexBracket appends indexes to the parent segment, e.g. "parent[0]",
+	// as lodash and JavaScript paths do. When expanding, "parent[]"
+	// appends after the highest index seen so far.
+	IndexBracket
+	// IndexDot writes indexes as bare numeric segments, e.g. "parent.0", as
+	// Viper, koanf and Terraform's flatmap do. Numeric map keys are then
+	// indistinguishable from indexes and expand as slices; only canonical
+	// numbers such as "7", not "07", are read as indexes.
+	IndexDot
+)
+
+type segmentKind uint8
+
+const (
+	keySegment segmentKind = iota
+	indexSegment
+	appendSegment
+	// Wildcards, only found in patterns
+	anySegment      // "*"
+	anyIndexSegment // "[*]"
+	anyPathSegment  // "**"
+)
+
+// segment is one step of a parsed flat key. end is the offset in the key just
+// past the segment, so key[:end] names the path up to and including it.
+type segment struct {
+	kind  segmentKind
+	name  string
+	index int
+	end   int
+}
+
+// indexKey returns the key of item i below prefix.
+func (o *Options) indexKey(prefix string, i int) string {
+	switch o.IndexStyle {
+	case IndexBracket:
+		return prefix + "[" + strconv.Itoa(i) + "]"
+	case IndexDot:
+		return joinPath(prefix, strconv.Itoa(i), o.Sep)
+	}
+	return fmt.Sprintf("%s%s[%d]", prefix, o.Sep, i)
+}
+
+// escapeKey escapes a map key or field name so that Expand reads it back as a
+// single key, when WithEscaping is set. Keys without the separator, brackets
+// or backslashes are returned unchanged.
+func (o *Options) escapeKey(key string) string {
+	if !o.Escaping {
+		return key
+	}
+	if o.IndexStyle == IndexDot && isCanonicalIndex(key) {
+		return `\` + key
+	}
+	if !strings.ContainsAny(key, `[]\`) && !strings.Contains(key, o.Sep) {
+		return key
+	}
+	var b strings.Builder
+	b.Grow(len(key) + 4)
+	for i := 0; i < len(key); {
+		if strings.HasPrefix(key[i:], o.Sep) {
+			for j := 0; j < len(o.Sep); j++ {
+				b.WriteByte('\\')
+				b.WriteByte(o.Sep[j])
+			}
+			i += len(o.Sep)
+			continue
+		}
+		switch key[i] {
+		case '\\', '[', ']':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(key[i])
+		i++
+	}
+	return b.String()
+}
+
+// parsePath splits a flat key into segments according to the separator and
+// index style, honoring backslash escapes when WithEscaping is set.
+func (o *Options) parsePath(key string) []segment {
+	return o.parse(key, false)
+}
+
+// parsePattern is like parsePath, but also recognizes the "*", "**" and "[*]"
+// wildcards.
+func (o *Options) parsePattern(pattern string) []segment {
+	return o.parse(pattern, true)
+}
+
+func (o *Options) parse(key string, pattern bool) []segment {
+	segments := make([]segment, 0, o.countParts(key))
+	start, escaped := 0, false
+	for i := 0; ; {
+		if i < len(key) {
+			if o.Escaping && key[i] == '\\' {
+				escaped = true
+				i += 2
+				continue
+			}
+			if !o.isSep(key, i) {
+				i++
+				continue
+			}
+		}
+		end := min(i, len(key))
+		segments = o.appendPart(segments, key[start:end], end, escaped, pattern)
+		if i >= len(key) {
+			return segments
+		}
+		i += len(o.Sep)
+		start, escaped = i, false
+	}
+}
+
+// isSep reports whether the separator starts at key[i].
+func (o *Options) isSep(key string, i int) bool {
+	if len(o.Sep) == 1 {
+		return key[i] == o.Sep[0]
+	}
+	return strings.HasPrefix(key[i:], o.Sep)
+}
+
+// countParts returns an upper bound of the number of segments in key.
+func (o *Options) countParts(key string) int {
+	n := strings.Count(key, o.Sep) + 1
+	if o.IndexStyle == IndexBracket {
+		n += strings.Count(key, "[")
+	}
+	return n
+}
+
+// appendPart appends the segments of part, the text between two separators
+// ending at end in its key. escaped tells whether part has backslash escapes.
+func (o *Options) appendPart(segments []segment, part string, end int, escaped, pattern bool) []segment {
+	switch {
+	case pattern && (part == "*" || part == "**"):
+		return append(segments, wildcard(part, end))
+	case pattern && part == "[*]" && o.IndexStyle == IndexDotBracket:
+		return append(segments, segment{kind: anyIndexSegment, end: end})
+	case o.IndexStyle == IndexBracket:
+		return o.appendBracketSegments(segments, part, end, pattern)
+	case escaped:
+		// Escaped parts are always keys, even if they look like indexes
+		return append(segments, segment{kind: keySegment, name: unescapeKey(part), end: end})
+	case o.IndexStyle == IndexDot:
+		if i, ok := parseIndex(part); ok && isCanonicalIndex(part) {
+			return append(segments, segment{kind: indexSegment, index: i, end: end})
+		}
+	default:
+		if i, ok := bracketIndex(part, o.StrictIndex); ok {
+			return append(segments, segment{kind: indexSegment, index: i, end: end})
+		}
+	}
+	return append(segments, segment{kind: keySegment, name: part, end: end})
+}
+
+// bracketIndex reads part as an index in the IndexDotBracket style. In strict
+// mode only "[n]" is an index; otherwise the first bracketed group counts, so
+// "foo[3]bar" is index 3, as it always has been.
+func bracketIndex(part string, strict bool) (int, bool) {
+	open := strings.IndexByte(part, '[')
+	if open < 0 || strict && open > 0 {
+		return 0, false
+	}
+	end := strings.IndexByte(part[open:], ']') + open
+	if end < open || strict && end != len(part)-1 {
+		return 0, false
+	}
+	return parseIndex(part[open+1 : end])
+}
+
+func wildcard(part string, end int) segment {
+	if part == "**" {
+		return segment{kind: anyPathSegment, end: end}
+	}
+	return segment{kind: anySegment, end: end}
+}
+
+// appendBracketSegments parses a part such as "name[0][]" that ends at end in
+// its key. Parts with anything but "[n]" or "[]" groups after the name are
+// plain keys.
+func (o *Options) appendBracketSegments(segments []segment, part string, end int, pattern bool) []segment {
+	name := part
+	var groups []segment
+	for strings.HasSuffix(name, "]") && !o.isEscaped(name, len(name)-1) {
+		open := strings.LastIndexByte(name, '[')
+		if open < 0 || o.isEscaped(name, open) {
+			break
+		}
+		group := name[open+1 : len(name)-1]
+		groupEnd := end - (len(part) - len(name))
+		if group == "" {
+			groups = append(groups, segment{kind: appendSegment, end: groupEnd})
+		} else if pattern && group == "*" {
+			groups = append(groups, segment{kind: anyIndexSegment, end: groupEnd})
+		} else if i, ok := parseIndex(group); ok {
+			groups = append(groups, segment{kind: indexSegment, index: i, end: groupEnd})
+		} else {
+			break
+		}
+		name = name[:open]
+	}
+	if name != "" || len(groups) == 0 {
+		if len(groups) > 0 && o.hasUnescapedBracket(name) {
+			// Not a clean name followed by index groups, keep it whole
+			return append(segments, segment{kind: keySegment, name: o.unescape(part), end: end})
+		}
+		nameEnd := end - (len(part) - len(name))
+		if pattern && (name == "*" || name == "**") {
+			segments = append(segments, wildcard(name, nameEnd))
+		} else {
+			segments = append(segments, segment{kind: keySegment, name: o.unescape(name), end: nameEnd})
+		}
+	}
+	for i := len(groups) - 1; i >= 0; i-- {
+		segments = append(segments, groups[i])
+	}
+	return segments
+}
+
+// isEscaped reports whether s[i] is preceded by an odd number of backslashes.
+func (o *Options) isEscaped(s string, i int) bool {
+	if !o.Escaping {
+		return false
+	}
+	n := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func (o *Options) hasUnescapedBracket(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] == '[' || s[i] == ']') && !o.isEscaped(s, i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Options) unescape(s string) string {
+	if !o.Escaping {
+		return s
+	}
+	return unescapeKey(s)
+}
+
+// unescapeKey removes backslash escapes, keeping the escaped characters.
+func unescapeKey(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+// parseIndex parses s as a non-negative decimal index. Unlike strconv.Atoi it
+// rejects signs, so "+1" and "-1" stay keys.
+func parseIndex(s string) (int, bool) {
+	if s == "" || len(s) > 18 {
+		return 0, false
+	}
+	i := 0
+	for j := 0; j < len(s); j++ {
+		if !isDigit(s[j]) {
+			return 0, false
+		}
+		i = i*10 + int(s[j]-'0')
+	}
+	return i, true
+}
+
+// isCanonicalIndex reports whether s is an index written without leading
+// zeros, such as "7" but not "07".
+func isCanonicalIndex(s string) bool {
+	_, ok := parseIndex(s)
+	return ok && (len(s) == 1 || s[0] != '0')
+}
@@ -0,0 +1,273 @@
+package bellows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlattenIndexStyles(t *testing.T) {
+	input := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "John", "tags": []string{"a"}},
+		},
+	}
+	tests := []struct {
+		name     string
+		style    IndexStyle
+		expected map[string]interface{}
+	}{
+		{
+			name:  "dot bracket",
+			style: IndexDotBracket,
+			expected: map[string]interface{}{
+				"users.[0].name":     "John",
+				"users.[0].tags.[0]": "a",
+			},
+		},
+		{
+			name:  "bracket",
+			style: IndexBracket,
+			expected: map[string]interface{}{
+				"users[0].name":    "John",
+				"users[0].tags[0]": "a",
+			},
+		},
+		{
+			name:  "dot",
+			style: IndexDot,
+			expected: map[string]interface{}{
+				"users.0.name":   "John",
+				"users.0.tags.0": "a",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flat := Flatten(input, WithIndexStyle(tt.style))
+			assert.Equal(t, tt.expected, flat)
+
+			expanded := Expand(flat, WithIndexStyle(tt.style))
+			assert.Equal(t, map[string]interface{}{
+				"users": []interface{}{
+					map[string]interface{}{"name": "John", "tags": []interface{}{"a"}},
+				},
+			}, expanded)
+		})
+	}
+}
+
+func TestExpandBracketStyle(t *testing.T) {
+	input := map[string]interface{}{
+		"matrix[0][1]": "b",
+		"matrix[0][0]": "a",
+		"tags[]":       "x",
+		"odd[x]":       1,
+		"[0]y":         2,
+	}
+	expected := map[string]interface{}{
+		"matrix": []interface{}{[]interface{}{"a", "b"}},
+		"tags":   []interface{}{"x"},
+		"odd[x]": 1,
+		"[0]y":   2,
+	}
+	assert.Equal(t, expected, Expand(input, WithIndexStyle(IndexBracket)))
+}
+
+func TestExpandBracketAppend(t *testing.T) {
+	input := map[string]interface{}{
+		"list[0]":   "first",
+		"list[]":    "appended",
+		"list[1].x": "second",
+	}
+	result, err := ExpandE(input, WithIndexStyle(IndexBracket))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"list": []interface{}{"first", map[string]interface{}{"x": "second"}, "appended"},
+	}, result)
+}
+
+func TestExpandDotStyle(t *testing.T) {
+	input := map[string]interface{}{
+		"list.0":   "a",
+		"list.1":   "b",
+		"codes.07": "leading zero",
+		"codes.x":  "y",
+	}
+	expected := map[string]interface{}{
+		"list":  []interface{}{"a", "b"},
+		"codes": map[string]interface{}{"07": "leading zero", "x": "y"},
+	}
+	assert.Equal(t, expected, Expand(input, WithIndexStyle(IndexDot)))
+}
+
+func TestExpandConflictPathWithBracketStyle(t *testing.T) {
+	_, err := ExpandE(map[string]interface{}{
+		"a.b[0]": 1,
+		"a.b.c":  2,
+	}, WithIndexStyle(IndexBracket))
+	var conflict *ConflictError
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, &ConflictError{Path: "a.b", Existing: "a.b.c", Incoming: "a.b[0]"}, conflict)
+}
+
+func TestEscapingRoundTrip(t *testing.T) {
+	input := map[string]interface{}{
+		"hosts": map[string]interface{}{
+			"example.com": "a",
+			"tags[prod]":  "b",
+			`C:\temp`:     "c",
+			"7":           "d",
+		},
+		"list": []interface{}{"x"},
+	}
+	styles := map[string]IndexStyle{
+		"dot bracket": IndexDotBracket,
+		"bracket":     IndexBracket,
+		"dot":         IndexDot,
+	}
+	for name, style := range styles {
+		t.Run(name, func(t *testing.T) {
+			flat := Flatten(input, WithEscaping(), WithIndexStyle(style))
+			expanded := Expand(flat, WithEscaping(), WithIndexStyle(style))
+			assert.Equal(t, map[string]interface{}{
+				"hosts": map[string]interface{}{
+					"example.com": "a",
+					"tags[prod]":  "b",
+					`C:\temp`:     "c",
+					"7":           "d",
+				},
+				"list": []interface{}{"x"},
+			}, expanded)
+		})
+	}
+}
+
+func TestFlattenEscaping(t *testing.T) {
+	input := map[string]interface{}{
+		"example.com": map[string]interface{}{"port": 443},
+		"tags[prod]":  true,
+		"plain":       1,
+	}
+	expected := map[string]interface{}{
+		`example\.com.port`: 443,
+		`tags\[prod\]`:      true,
+		"plain":             1,
+	}
+	assert.Equal(t, expected, Flatten(input, WithEscaping()))
+	assert.Equal(t, map[string]interface{}{"0": 1}, Flatten(map[string]interface{}{"0": 1}, WithEscaping()))
+	assert.Equal(t, map[string]interface{}{`\0`: 1}, Flatten(map[string]interface{}{"0": 1}, WithEscaping(), WithIndexStyle(IndexDot)))
+}
+
+func TestEscapingMultiCharSeparator(t *testing.T) {
+	input := map[string]interface{}{
+		"a:::b": map[string]interface{}{"c": 1},
+	}
+	flat := Flatten(input, WithEscaping(), WithSep("::"))
+	assert.Equal(t, map[string]interface{}{`a\:\::b::c`: 1}, flat)
+	assert.Equal(t, input, Expand(flat, WithEscaping(), WithSep("::")))
+}
+
+func TestExpandEscapedBracketStyle(t *testing.T) {
+	input := map[string]interface{}{
+		`a\.b[0]`:   "x",
+		`c\[0\]`:    "y",
+		`d\[0\][1]`: "z",
+	}
+	expected := map[string]interface{}{
+		"a.b":  []interface{}{"x"},
+		"c[0]": "y",
+		"d[0]": []interface{}{nil, "z"},
+	}
+	assert.Equal(t, expected, Expand(input, WithEscaping(), WithIndexStyle(IndexBracket)))
+}
+
+func TestParsePathSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		key      string
+		expected []segment
+	}{
+		{
+			name: "dot bracket",
+			key:  "a.[10].b",
+			expected: []segment{
+				{kind: keySegment, name: "a", end: 1},
+				{kind: indexSegment, index: 10, end: 6},
+				{kind: keySegment, name: "b", end: 8},
+			},
+		},
+		{
+			name: "signed indexes stay keys",
+			key:  "[-1].[+1]",
+			expected: []segment{
+				{kind: keySegment, name: "[-1]", end: 4},
+				{kind: keySegment, name: "[+1]", end: 9},
+			},
+		},
+		{
+			name: "embedded indexes",
+			key:  "a[0].foo[3]bar.[x]",
+			expected: []segment{
+				{kind: indexSegment, index: 0, end: 4},
+				{kind: indexSegment, index: 3, end: 14},
+				{kind: keySegment, name: "[x]", end: 18},
+			},
+		},
+		{
+			name: "embedded indexes stay keys in strict mode",
+			opts: []Option{WithStrictIndex()},
+			key:  "a[0].[1]",
+			expected: []segment{
+				{kind: keySegment, name: "a[0]", end: 4},
+				{kind: indexSegment, index: 1, end: 8},
+			},
+		},
+		{
+			name: "multi-character separator",
+			opts: []Option{WithSep("::")},
+			key:  "a::[2]",
+			expected: []segment{
+				{kind: keySegment, name: "a", end: 1},
+				{kind: indexSegment, index: 2, end: 6},
+			},
+		},
+		{
+			name: "escaped separator",
+			opts: []Option{WithEscaping()},
+			key:  `a\.b.[0]`,
+			expected: []segment{
+				{kind: keySegment, name: "a.b", end: 4},
+				{kind: indexSegment, index: 0, end: 8},
+			},
+		},
+		{
+			name: "bracket",
+			opts: []Option{WithIndexStyle(IndexBracket)},
+			key:  "a[1][].b",
+			expected: []segment{
+				{kind: keySegment, name: "a", end: 1},
+				{kind: indexSegment, index: 1, end: 4},
+				{kind: appendSegment, end: 6},
+				{kind: keySegment, name: "b", end: 8},
+			},
+		},
+		{
+			name: "dot",
+			opts: []Option{WithIndexStyle(IndexDot)},
+			key:  "a.07.7",
+			expected: []segment{
+				{kind: keySegment, name: "a", end: 1},
+				{kind: keySegment, name: "07", end: 4},
+				{kind: indexSegment, index: 7, end: 6},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, newOptions(tt.opts).parsePath(tt.key))
+		})
+	}
+}
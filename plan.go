@@ -0,0 +1,72 @@
+package bellows
+
+import (
+	"reflect"
+	"sync"
+)
+
+// typePlan holds what walking and decoding need to know about a type, so a
+// Flattener or Expander only inspects each type once.
+type typePlan struct {
+	// leaf reports isLeafType, and leafValue isLeafValueType when pointers
+	// are dereferenced.
+	leaf      bool
+	leafValue bool
+	// generated reports whether the struct flattens itself as a
+	// MapFlattener.
+	generated bool
+	// fields are the struct fields of the type, and keys their escaped
+	// names when known up front.
+	fields []fieldInfo
+	keys   []string
+}
+
+// fieldKey returns the escaped key of fields[i].
+func (p typePlan) fieldKey(o *Options, i int) string {
+	if p.keys != nil {
+		return p.keys[i]
+	}
+	return o.escapeKey(p.fields[i].name)
+}
+
+// plan returns the plan of t. Options built by NewFlattener or NewExpander
+// keep plans per type; others derive them from the package-wide caches.
+func (o *Options) plan(t reflect.Type) typePlan {
+	if o.plans == nil {
+		return o.newPlan(t, false)
+	}
+	if p, ok := o.plans.Load(t); ok {
+		return *p.(*typePlan)
+	}
+	p := o.newPlan(t, true)
+	stored, _ := o.plans.LoadOrStore(t, &p)
+	return *stored.(*typePlan)
+}
+
+// newPlan inspects t. full also precomputes the answers that are otherwise
+// worked out on demand.
+func (o *Options) newPlan(t reflect.Type, full bool) typePlan {
+	p := typePlan{leaf: o.isLeafType(t)}
+	if full || o.DerefPointers {
+		p.leafValue = o.isLeafValueType(t)
+	}
+	if t.Kind() == reflect.Struct {
+		p.generated = o.usesMapFlattener(t)
+		p.fields = cachedStructFields(t, o.TagName)
+		if full {
+			p.keys = make([]string, len(p.fields))
+			for i, f := range p.fields {
+				p.keys[i] = o.escapeKey(f.name)
+			}
+		}
+	}
+	return p
+}
+
+// withPlans returns a copy of o that caches type plans, for reuse across
+// calls and goroutines.
+func (o *Options) withPlans() *Options {
+	c := *o
+	c.plans = new(sync.Map)
+	return &c
+}
@@ -0,0 +1,101 @@
+package bellows
+
+// Flattener flattens values with a fixed configuration. It caches what it
+// learns about each type it sees, such as struct field keys and leaf
+// decisions, so flattening many values of the same types is cheaper than
+// calling Flatten each time. A Flattener is safe for concurrent use.
+type Flattener struct {
+	opts *Options
+}
+
+// NewFlattener returns a Flattener configured by opts.
+func NewFlattener(opts ...Option) *Flattener {
+	return &Flattener{opts: newOptions(opts).withPlans()}
+}
+
+// Flatten is like the package-level Flatten.
+func (f *Flattener) Flatten(value interface{}) map[string]interface{} {
+	m, _ := flatten(value, f.opts)
+	return m
+}
+
+// FlattenE is like the package-level FlattenE.
+func (f *Flattener) FlattenE(value interface{}) (map[string]interface{}, error) {
+	m, err := flattenChecked(value, f.opts)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FlattenPrefixed is like the package-level FlattenPrefixed.
+func (f *Flattener) FlattenPrefixed(value interface{}, prefix string) map[string]interface{} {
+	m := make(map[string]interface{}, 5)
+	f.FlattenPrefixedToResult(value, prefix, m)
+	return m
+}
+
+// FlattenPrefixedToResult is like the package-level FlattenPrefixedToResult.
+func (f *Flattener) FlattenPrefixedToResult(value interface{}, prefix string, m map[string]interface{}) {
+	_ = flattenInto(value, prefix, m, f.opts)
+}
+
+// FlattenPrefixedToResultE is like the package-level
+// FlattenPrefixedToResultE.
+func (f *Flattener) FlattenPrefixedToResultE(value interface{}, prefix string, m map[string]interface{}) error {
+	return flattenCheckedInto(value, prefix, m, f.opts)
+}
+
+// Walk is like the package-level Walk.
+func (f *Flattener) Walk(value interface{}, fn func(key string, v interface{}) error) error {
+	w := newWalker(f.opts, f.opts.Prefix, fn)
+	return w.run(value)
+}
+
+// Expander expands flat maps with a fixed configuration, caching struct
+// metadata for ExpandInto like Flattener does. An Expander is safe for
+// concurrent use.
+type Expander struct {
+	opts *Options
+}
+
+// NewExpander returns an Expander configured by opts.
+func NewExpander(opts ...Option) *Expander {
+	return &Expander{opts: newOptions(opts).withPlans()}
+}
+
+// Expand is like the package-level Expand.
+func (e *Expander) Expand(flatMap map[string]interface{}) interface{} {
+	root, _ := expand(flatMap, e.opts, true)
+	if root == nil {
+		return nil
+	}
+	return root.build(e.opts)
+}
+
+// ExpandE is like the package-level ExpandE.
+func (e *Expander) ExpandE(flatMap map[string]interface{}) (interface{}, error) {
+	root, err := expand(flatMap, e.opts, true)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, nil
+	}
+	return root.build(e.opts), nil
+}
+
+// ExpandInto is like the package-level ExpandInto.
+func (e *Expander) ExpandInto(flatMap map[string]interface{}, dst interface{}) error {
+	return expandInto(flatMap, dst, e.opts)
+}
+
+// ExpandPrefixedInto is like the package-level ExpandPrefixedInto.
+func (e *Expander) ExpandPrefixedInto(flatMap map[string]interface{}, prefix string, dst interface{}) error {
+	return expandPrefixedInto(flatMap, prefix, dst, e.opts)
+}
+
+// DecodeInto is like the package-level DecodeInto.
+func (e *Expander) DecodeInto(src interface{}, path string, dst interface{}) error {
+	return decodeInto(src, path, dst, e.opts)
+}
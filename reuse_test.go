@@ -0,0 +1,71 @@
+package bellows
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type reuseConfig struct {
+	Name    string            `json:"name"`
+	Port    int               `json:"port,omitempty"`
+	Labels  map[string]string `json:"labels"`
+	Servers []reuseServer     `json:"servers"`
+}
+
+type reuseServer struct {
+	Host string `json:"host"`
+}
+
+func TestFlattenerMatchesFlatten(t *testing.T) {
+	input := reuseConfig{
+		Name:    "app",
+		Labels:  map[string]string{"a.b": "c"},
+		Servers: []reuseServer{{Host: "x"}, {Host: "y"}},
+	}
+	opts := []Option{WithTagName("json"), WithEscaping()}
+	f := NewFlattener(opts...)
+
+	expected := Flatten(input, opts...)
+	assert.Equal(t, expected, f.Flatten(input))
+	// The second call is served from the cached plans
+	assert.Equal(t, expected, f.Flatten(input))
+	assert.Equal(t, map[string]interface{}{"cfg.name": "app"}, f.FlattenPrefixed(reuseConfig{Name: "app"}, "cfg"))
+}
+
+func TestExpanderRoundTrip(t *testing.T) {
+	input := reuseConfig{Name: "app", Port: 80, Servers: []reuseServer{{Host: "x"}}}
+	f := NewFlattener(WithTagName("json"))
+	e := NewExpander(WithTagName("json"))
+
+	var output reuseConfig
+	assert.NoError(t, e.ExpandInto(f.Flatten(input), &output))
+	assert.Equal(t, input, output)
+	assert.Equal(t, Expand(f.Flatten(input)), e.Expand(f.Flatten(input)))
+}
+
+func TestFlattenerConcurrentUse(t *testing.T) {
+	f := NewFlattener(WithTagName("json"))
+	e := NewExpander(WithTagName("json"))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				input := reuseConfig{Name: "app", Port: i*100 + j}
+				var output reuseConfig
+				if err := e.ExpandInto(f.Flatten(input), &output); err != nil {
+					t.Error(err)
+					return
+				}
+				if output.Port != input.Port {
+					t.Errorf("got port %d, want %d", output.Port, input.Port)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -206,4 +206,169 @@ func TestFlattenStructWithMixedFieldTypesSafe(t *testing.T) {
 	assert.Contains(t, result, "ExportedSlice.[1]")
 	assert.Contains(t, result, "ExportedMap.key1")
 	assert.Contains(t, result, "ExportedMap.key2")
-}
\ No newline at end of file
+}
+
+type TaggedBase struct {
+	ID string `json:"id"`
+}
+
+type taggedServer struct {
+	TaggedBase `json:",inline"`
+	Host       string            `json:"host"`
+	Port       int               `json:"port,omitempty"`
+	Secret     string            `json:"-"`
+	Meta       taggedMeta        `json:"meta,squash"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Untagged   string
+}
+
+type taggedMeta struct {
+	Owner string `json:"owner"`
+}
+
+func TestFlattenStructWithTags(t *testing.T) {
+	input := taggedServer{
+		Host:     "localhost",
+		Secret:   "hunter2",
+		Meta:     taggedMeta{Owner: "ops"},
+		Untagged: "plain",
+	}
+	expected := map[string]interface{}{
+		"id":       "",
+		"host":     "localhost",
+		"owner":    "ops",
+		"Untagged": "plain",
+	}
+	result := Flatten(input, WithTagName("json"))
+	assert.Equal(t, expected, result)
+}
+
+func TestFlattenStructWithTagsEmbeddedExported(t *testing.T) {
+	type Named struct {
+		B `json:"b"`
+		F int `json:"f"`
+	}
+	expected := map[string]interface{}{
+		"b.C": "c",
+		"b.D": 1,
+		"f":   2,
+	}
+	result := Flatten(Named{B: B{C: "c", D: 1}, F: 2}, WithTagName("json"))
+	assert.Equal(t, expected, result)
+}
+
+func TestStructTagsRoundTrip(t *testing.T) {
+	input := taggedServer{
+		TaggedBase: TaggedBase{ID: "srv-1"},
+		Host:       "localhost",
+		Port:       8080,
+		Secret:     "hunter2",
+		Meta:       taggedMeta{Owner: "ops"},
+		Labels:     map[string]string{"env": "prod"},
+		Untagged:   "plain",
+	}
+	flat := Flatten(input, WithTagName("json"))
+	assert.Equal(t, "prod", flat["labels.env"])
+	assert.Equal(t, 8080, flat["port"])
+	assert.Equal(t, "srv-1", flat["id"])
+
+	var result taggedServer
+	err := ExpandInto(flat, &result, WithTagName("json"))
+	assert.NoError(t, err)
+	input.Secret = ""
+	assert.Equal(t, input, result)
+}
+
+func TestStructTagsInlineMapRoundTrip(t *testing.T) {
+	type settings struct {
+		Name       string `yaml:"name"`
+		TaggedBase `yaml:",inline"`
+		Extra      map[string]interface{} `yaml:",inline"`
+	}
+	input := settings{
+		Name:       "n",
+		TaggedBase: TaggedBase{ID: "ID"},
+		Extra:      map[string]interface{}{"k": "v", "nested": map[string]interface{}{"a": 1}},
+	}
+	flat := Flatten(input, WithTagName("yaml"))
+	assert.Equal(t, map[string]interface{}{"name": "n", "ID": "ID", "k": "v", "nested.a": 1}, flat)
+
+	// The inline map only gets the keys no other field uses
+	var result settings
+	assert.NoError(t, ExpandInto(flat, &result, WithTagName("yaml")))
+	assert.Equal(t, input, result)
+
+	result = settings{}
+	assert.NoError(t, ExpandInto(map[string]interface{}{"name": "n"}, &result, WithTagName("yaml")))
+	assert.Nil(t, result.Extra)
+}
+
+func TestFlattenDerefPointers(t *testing.T) {
+	type User struct {
+		Name    *string
+		Age     *int
+		Email   *string
+		Aliases []*string
+		Scores  map[string]*int
+		Double  **int
+	}
+	name, alias, age, score := "John", "Johnny", 30, 7
+	agePtr := &age
+	input := User{
+		Name:    &name,
+		Age:     &age,
+		Aliases: []*string{&alias, nil},
+		Scores:  map[string]*int{"math": &score},
+		Double:  &agePtr,
+	}
+
+	expected := map[string]interface{}{
+		"Name":        "John",
+		"Age":         30,
+		"Email":       nil,
+		"Aliases.[0]": "Johnny",
+		"Aliases.[1]": nil,
+		"Scores.math": 7,
+		"Double":      30,
+	}
+	assert.Equal(t, expected, Flatten(input, WithDerefPointers()))
+
+	delete(expected, "Email")
+	delete(expected, "Aliases.[1]")
+	assert.Equal(t, expected, Flatten(input, WithDerefPointers(), WithOmitNilPointers()))
+}
+
+func TestFlattenOmitNilPointers(t *testing.T) {
+	type User struct {
+		Name *string
+		Tags map[string]interface{}
+	}
+	input := User{Tags: map[string]interface{}{"explicit": nil}}
+	expected := map[string]interface{}{
+		"Tags.explicit": nil,
+	}
+	assert.Equal(t, expected, Flatten(input, WithOmitNilPointers()))
+}
+
+func TestFlattenStructFieldsCachedPerTagName(t *testing.T) {
+	type Tagged struct {
+		Name string `json:"name" yaml:"title"`
+	}
+	input := Tagged{Name: "x"}
+	assert.Equal(t, map[string]interface{}{"name": "x"}, Flatten(input, WithTagName("json")))
+	assert.Equal(t, map[string]interface{}{"title": "x"}, Flatten(input, WithTagName("yaml")))
+	assert.Equal(t, map[string]interface{}{"Name": "x"}, Flatten(input))
+}
+
+func TestFlattenReusesKeyBuffer(t *testing.T) {
+	input := map[string]interface{}{
+		"a": []interface{}{map[string]interface{}{"long_key": 1}, "short"},
+		"b": map[string]interface{}{"c": map[string]interface{}{"d": true}},
+	}
+	expected := map[string]interface{}{
+		"p.a.[0].long_key": 1,
+		"p.a.[1]":          "short",
+		"p.b.c.d":          true,
+	}
+	assert.Equal(t, expected, Flatten(input, WithPrefix("p")))
+}
@@ -0,0 +1,32 @@
+package bellows
+
+import (
+	"errors"
+	"iter"
+)
+
+// errStopWalk ends a walk early when an All consumer stops iterating.
+var errStopWalk = errors.New("bellows: walk stopped")
+
+// Walk flattens value like Flatten, but calls fn with each key and leaf value
+// instead of building a map. Walking stops at the first error, from fn or
+// from flattening, and Walk returns it.
+func Walk(value interface{}, fn func(key string, v interface{}) error, opts ...Option) error {
+	options := newOptions(opts)
+	w := newWalker(options, options.Prefix, fn)
+	return w.run(value)
+}
+
+// All returns an iterator over the keys and leaf values Flatten would
+// produce for value. Iteration ends early when the consumer stops, or
+// silently at the first flattening error; use Walk to see errors.
+func All(value interface{}, opts ...Option) iter.Seq2[string, any] {
+	return func(yield func(string, any) bool) {
+		_ = Walk(value, func(key string, v interface{}) error {
+			if !yield(key, v) {
+				return errStopWalk
+			}
+			return nil
+		}, opts...)
+	}
+}
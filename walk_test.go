@@ -0,0 +1,68 @@
+package bellows
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalk(t *testing.T) {
+	input := map[string]interface{}{
+		"user": map[string]interface{}{
+			"name": "John",
+			"tags": []string{"a", "b"},
+		},
+	}
+	result := map[string]interface{}{}
+	err := Walk(input, func(key string, v interface{}) error {
+		result[key] = v
+		return nil
+	}, WithSep("_"))
+	assert.NoError(t, err)
+	assert.Equal(t, Flatten(input, WithSep("_")), result)
+}
+
+func TestWalkStopsOnError(t *testing.T) {
+	errFull := errors.New("full")
+	input := []int{1, 2, 3, 4}
+	var keys []string
+	err := Walk(input, func(key string, v interface{}) error {
+		keys = append(keys, key)
+		if len(keys) == 2 {
+			return errFull
+		}
+		return nil
+	}, WithPrefix("n"))
+	assert.ErrorIs(t, err, errFull)
+	assert.Equal(t, []string{"n.[0]", "n.[1]"}, keys)
+}
+
+func TestWalkReportsCycles(t *testing.T) {
+	m := map[string]interface{}{}
+	m["self"] = m
+	err := Walk(m, func(string, interface{}) error { return nil })
+	var cycleErr *CycleError
+	assert.ErrorAs(t, err, &cycleErr)
+}
+
+func TestAllIterator(t *testing.T) {
+	input := A{F: 1, B: B{C: "test", D: 2}}
+	result := map[string]interface{}{}
+	for key, v := range All(input) {
+		result[key] = v
+	}
+	assert.Equal(t, Flatten(input), result)
+}
+
+func TestAllIteratorEarlyBreak(t *testing.T) {
+	input := []int{1, 2, 3, 4}
+	var keys []string
+	for key := range All(input, WithPrefix("n")) {
+		keys = append(keys, key)
+		if len(keys) == 3 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"n.[0]", "n.[1]", "n.[2]"}, keys)
+}